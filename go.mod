@@ -5,6 +5,9 @@ go 1.17
 require (
 	github.com/sensu-community/sensu-plugin-sdk v0.12.0
 	github.com/sensu/sensu-go/types v0.3.0
+	golang.org/x/crypto v0.0.0-20220331220935-ae2d96664a29
+	gopkg.in/yaml.v2 v2.3.0
+	software.sslmate.com/src/go-pkcs12 v0.2.0
 )
 
 require (
@@ -37,12 +40,11 @@ require (
 	github.com/spf13/pflag v1.0.3 // indirect
 	github.com/spf13/viper v1.7.0 // indirect
 	github.com/subosito/gotenv v1.2.0 // indirect
-	golang.org/x/net v0.0.0-20190620200207-3b0461eec859 // indirect
-	golang.org/x/sys v0.0.0-20190624142023-c5567b49c5d0 // indirect
-	golang.org/x/text v0.3.2 // indirect
+	golang.org/x/net v0.0.0-20211112202133-69e39bad7dc2 // indirect
+	golang.org/x/sys v0.0.0-20210615035016-665e8c7367d1 // indirect
+	golang.org/x/text v0.3.6 // indirect
 	google.golang.org/genproto v0.0.0-20191108220845-16a3f7862a1a // indirect
 	google.golang.org/grpc v1.24.0 // indirect
 	gopkg.in/ini.v1 v1.51.0 // indirect
 	gopkg.in/sourcemap.v1 v1.0.5 // indirect
-	gopkg.in/yaml.v2 v2.3.0 // indirect
 )
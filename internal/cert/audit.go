@@ -0,0 +1,166 @@
+package cert
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+)
+
+// tlsVersions probed by the TLS audit, oldest first.
+var tlsVersions = []uint16{tls.VersionTLS10, tls.VersionTLS11, tls.VersionTLS12, tls.VersionTLS13}
+
+var tlsVersionNames = map[uint16]string{
+	tls.VersionTLS10: "TLS 1.0",
+	tls.VersionTLS11: "TLS 1.1",
+	tls.VersionTLS12: "TLS 1.2",
+	tls.VersionTLS13: "TLS 1.3",
+}
+
+// TLSVersionName of a TLS protocol version, such as TLS 1.2.
+func TLSVersionName(version uint16) string {
+	if n, ok := tlsVersionNames[version]; ok {
+		return n
+	}
+	return fmt.Sprintf("0x%04X", version)
+}
+
+// TLSAudit lists the protocol versions and cipher suites a server accepts.
+type TLSAudit struct {
+	Versions []TLSVersionAudit
+	// Err is set when the server could not be reached during the audit
+	Err error
+}
+
+// TLSVersionAudit of a single protocol version.
+type TLSVersionAudit struct {
+	Version  uint16
+	Accepted bool
+	// CipherSuites accepted with this version, in the server's order of
+	// preference. TLS 1.3 suites cannot be chosen by the client, so only the
+	// negotiated suite is listed.
+	CipherSuites []uint16
+}
+
+// auditTLS performs handshakes constrained to each protocol version, and
+// for TLS 1.0 to 1.2 repeats them offering the suites not yet accepted, until
+// the server rejects the remaining suites.
+func auditTLS(ctx context.Context, connect func() (net.Conn, error), base *tls.Config) *TLSAudit {
+	audit := &TLSAudit{}
+	for _, version := range tlsVersions {
+		va := TLSVersionAudit{Version: version}
+		candidates := cipherSuitesFor(version)
+		for {
+			cfg := base.Clone()
+			cfg.MinVersion, cfg.MaxVersion = version, version
+			if version != tls.VersionTLS13 {
+				if len(candidates) == 0 {
+					break
+				}
+				cfg.CipherSuites = candidates
+			}
+			state, err := probeTLS(ctx, connect, cfg)
+			if err != nil {
+				audit.Err = err
+				return audit
+			}
+			if state == nil {
+				break
+			}
+			va.Accepted = true
+			va.CipherSuites = append(va.CipherSuites, state.CipherSuite)
+			if version == tls.VersionTLS13 {
+				break
+			}
+			candidates = removeSuite(candidates, state.CipherSuite)
+		}
+		audit.Versions = append(audit.Versions, va)
+	}
+	return audit
+}
+
+// probeTLS completes a handshake with cfg, returning nil when the server
+// rejects it. Errors are only returned when the server cannot be reached.
+func probeTLS(ctx context.Context, connect func() (net.Conn, error), cfg *tls.Config) (*tls.ConnectionState, error) {
+	conn, err := connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	tlsConn := tls.Client(conn, cfg)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			return nil, err
+		}
+		return nil, nil
+	}
+	state := tlsConn.ConnectionState()
+	return &state, nil
+}
+
+// cipherSuitesFor lists every cipher suite implemented for a TLS 1.0 to 1.2
+// protocol version, secure suites first.
+func cipherSuitesFor(version uint16) []uint16 {
+	var suites []uint16
+	for _, s := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		for _, v := range s.SupportedVersions {
+			if v == version && v != tls.VersionTLS13 {
+				suites = append(suites, s.ID)
+				break
+			}
+		}
+	}
+	return suites
+}
+
+func removeSuite(suites []uint16, id uint16) []uint16 {
+	remaining := make([]uint16, 0, len(suites))
+	for _, s := range suites {
+		if s != id {
+			remaining = append(remaining, s)
+		}
+	}
+	return remaining
+}
+
+// isInsecureSuite reports whether the suite is one crypto/tls considers
+// insecure, such as RC4 and 3DES suites.
+func isInsecureSuite(id uint16) bool {
+	for _, s := range tls.InsecureCipherSuites() {
+		if s.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluateTLSAudit reports accepted versions older than minVersion, when
+// set, and accepted insecure cipher suites.
+func evaluateTLSAudit(audit *TLSAudit, minVersion uint16) []Finding {
+	if audit.Err != nil {
+		return []Finding{{Status: StatusWarning, Message: fmt.Sprintf("TLS audit failed: %v", audit.Err)}}
+	}
+	var findings []Finding
+	insecure := map[uint16]bool{}
+	for _, va := range audit.Versions {
+		if va.Accepted && va.Version < minVersion {
+			findings = append(findings, Finding{
+				Status:  StatusCritical,
+				Message: fmt.Sprintf("server accepts %s, minimum is %s", TLSVersionName(va.Version), TLSVersionName(minVersion)),
+			})
+		}
+		for _, s := range va.CipherSuites {
+			if isInsecureSuite(s) && !insecure[s] {
+				insecure[s] = true
+				findings = append(findings, Finding{
+					Status:  StatusWarning,
+					Message: fmt.Sprintf("server accepts insecure cipher suite %s", tls.CipherSuiteName(s)),
+				})
+			}
+		}
+	}
+	return findings
+}
@@ -0,0 +1,145 @@
+package cert_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sensu/cert-checks/internal/cert"
+	"github.com/sensu/cert-checks/internal/cert/testcert"
+)
+
+func TestCollectMetricsTLSAudit(t *testing.T) {
+	ctx := context.Background()
+
+	// ed25519 certificates cannot be used before TLS 1.2
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate key: %v", err)
+	}
+	serverPair, _, err := testcert.NewWithKey("audit.sensu.io", time.Now().Add(-time.Hour), time.Hour*72, key)
+	if err != nil {
+		t.Fatalf("could not create server certificate: %v", err)
+	}
+	serve := func(tlsCfg *tls.Config) string {
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+		// rejected handshakes are expected
+		srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+		tlsCfg.Certificates = []tls.Certificate{serverPair}
+		srv.TLS = tlsCfg
+		srv.StartTLS()
+		t.Cleanup(srv.Close)
+		return "tcp://" + srv.Listener.Addr().String()
+	}
+
+	testCases := []struct {
+		Name           string
+		Server         *tls.Config
+		MinVersion     uint16
+		ExpectedStatus cert.Status
+		Expected       []cert.TLSVersionAudit
+	}{
+		{
+			Name:           "modern server",
+			Server:         &tls.Config{MinVersion: tls.VersionTLS12, MaxVersion: tls.VersionTLS12, CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}},
+			MinVersion:     tls.VersionTLS12,
+			ExpectedStatus: cert.StatusOK,
+			Expected: []cert.TLSVersionAudit{
+				{Version: tls.VersionTLS10},
+				{Version: tls.VersionTLS11},
+				{Version: tls.VersionTLS12, Accepted: true, CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}},
+				{Version: tls.VersionTLS13},
+			},
+		}, {
+			Name:           "TLS 1.3 only",
+			Server:         &tls.Config{MinVersion: tls.VersionTLS13},
+			MinVersion:     tls.VersionTLS12,
+			ExpectedStatus: cert.StatusOK,
+			Expected: []cert.TLSVersionAudit{
+				{Version: tls.VersionTLS10},
+				{Version: tls.VersionTLS11},
+				{Version: tls.VersionTLS12},
+				{Version: tls.VersionTLS13, Accepted: true, CipherSuites: []uint16{tls.TLS_AES_128_GCM_SHA256}},
+			},
+		}, {
+			Name: "legacy versions",
+			Server: &tls.Config{
+				MinVersion:   tls.VersionTLS10,
+				MaxVersion:   tls.VersionTLS12,
+				CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA, tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA},
+			},
+			MinVersion:     tls.VersionTLS12,
+			ExpectedStatus: cert.StatusCritical,
+			Expected: []cert.TLSVersionAudit{
+				{Version: tls.VersionTLS10, Accepted: true, CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA, tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA}},
+				{Version: tls.VersionTLS11, Accepted: true, CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA, tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA}},
+				{Version: tls.VersionTLS12, Accepted: true, CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA, tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA}},
+				{Version: tls.VersionTLS13},
+			},
+		}, {
+			Name: "legacy versions without policy",
+			Server: &tls.Config{
+				MinVersion:   tls.VersionTLS10,
+				MaxVersion:   tls.VersionTLS10,
+				CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA},
+			},
+			ExpectedStatus: cert.StatusOK,
+			Expected: []cert.TLSVersionAudit{
+				{Version: tls.VersionTLS10, Accepted: true, CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA}},
+				{Version: tls.VersionTLS11},
+				{Version: tls.VersionTLS12},
+				{Version: tls.VersionTLS13},
+			},
+		}, {
+			Name: "insecure cipher suite",
+			Server: &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				MaxVersion:   tls.VersionTLS12,
+				CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_RC4_128_SHA},
+			},
+			MinVersion:     tls.VersionTLS12,
+			ExpectedStatus: cert.StatusWarning,
+			Expected: []cert.TLSVersionAudit{
+				{Version: tls.VersionTLS10},
+				{Version: tls.VersionTLS11},
+				{Version: tls.VersionTLS12, Accepted: true, CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_RC4_128_SHA}},
+				{Version: tls.VersionTLS13},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			target := serve(tc.Server)
+			actual, err := collectSingle(t, ctx, target, cert.Config{AuditTLS: true, MinTLSVersion: tc.MinVersion})
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if actual.TLSAudit == nil || actual.TLSAudit.Err != nil {
+				t.Fatalf("expected TLS audit. actual: %v", actual.TLSAudit)
+			}
+			if !reflect.DeepEqual(actual.TLSAudit.Versions, tc.Expected) {
+				t.Errorf("expected versions %v. actual: %v", tc.Expected, actual.TLSAudit.Versions)
+			}
+			if status := actual.Status(); status != tc.ExpectedStatus {
+				t.Errorf("expected status %v. actual: %v (%v)", tc.ExpectedStatus, status, actual.Findings)
+			}
+		})
+	}
+
+	actual, err := collectSingle(t, ctx, serve(&tls.Config{}), cert.Config{})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if actual.TLSAudit != nil {
+		t.Errorf("expected no TLS audit by default. actual: %v", actual.TLSAudit)
+	}
+}
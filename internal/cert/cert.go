@@ -5,54 +5,82 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
 
-const secondsToDays = float64(60 * 60 * 24)
-
-type Metrics struct {
-	EvaluatedAt         time.Time
-	SecondsSinceIssued  int
-	SecondsUntilExpires int
-	Tags                map[string]string
-}
-
-func (m Metrics) Output() string {
-	epoch := m.EvaluatedAt.UnixMilli()
-	var tags string
-	if len(m.Tags) > 0 {
-		buf := bytes.Buffer{}
-		separator := ""
-		for tag, value := range m.Tags {
-			fmt.Fprintf(&buf, "%s%s=\"%s\"", separator, tag, value)
-			if separator == "" {
-				separator = ", "
-			}
-		}
-		tags = fmt.Sprintf("{%s}", buf.String())
+// Status of a certificate evaluation, ordered by severity.
+type Status int
+
+const (
+	StatusOK Status = iota
+	StatusWarning
+	StatusCritical
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusOK:
+		return "OK"
+	case StatusWarning:
+		return "WARNING"
+	default:
+		return "CRITICAL"
+	}
+}
+
+// Finding is a problem detected while evaluating a certificate.
+type Finding struct {
+	Status  Status
+	Message string
+}
+
+// Reasons a certificate location could not be collected.
+const (
+	ReasonParse     = "parse"
+	ReasonDial      = "dial"
+	ReasonHandshake = "handshake"
+	ReasonLoad      = "load"
+	ReasonTimeout   = "timeout"
+)
+
+// CollectError is returned when a certificate location cannot be collected,
+// classified by the stage that failed.
+type CollectError struct {
+	Reason string
+	Err    error
+}
+
+func (e *CollectError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *CollectError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorReason classifies an error returned by CollectMetrics as one of the
+// Reason constants. Errors not classified by a CollectError are load errors.
+func ErrorReason(err error) string {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout() {
+		return ReasonTimeout
 	}
-	lines := []string{
-		"# HELP cert_days_left number of days until certificate expires. Expired certificates produce negative numbers.",
-		"# TYPE cert_days_left gauge",
-		fmt.Sprintf("cert_days_left%s %f %d", tags, float64(m.SecondsUntilExpires)/secondsToDays, epoch),
-		"# HELP cert_seconds_left number of seconds until certificate expires. Expired certificates produce negative numbers.",
-		"# TYPE cert_seconds_left gauge",
-		fmt.Sprintf("cert_seconds_left%s %d %d", tags, m.SecondsUntilExpires, epoch),
-		"# HELP cert_issued_days total number of days since certificate was issued.",
-		"# TYPE cert_issued_days counter",
-		fmt.Sprintf("cert_issued_days%s %f %d", tags, float64(m.SecondsSinceIssued)/secondsToDays, epoch),
-		"# HELP cert_issued_seconds total number of seconds since the certificate was issued.",
-		"# TYPE cert_issued_seconds counter",
-		fmt.Sprintf("cert_issued_seconds%s %d %d", tags, m.SecondsSinceIssued, epoch),
+	var collectErr *CollectError
+	if errors.As(err, &collectErr) {
+		return collectErr.Reason
 	}
-	return strings.Join(lines, "\n")
+	return ReasonLoad
 }
 
 // Config for evaluating metrics
@@ -60,23 +88,129 @@ type Config struct {
 	// Now provider defaults to time.Now() when not provided
 	Now        func() time.Time
 	ServerName string
+	// Warning and Critical are thresholds on the time remaining until the
+	// certificate expires. A zero value disables the threshold. Expired
+	// certificates are always critical.
+	Warning  time.Duration
+	Critical time.Duration
+	// Verify the chain against the trusted roots. The roots are loaded from
+	// CAFile and CADir when set, or from the system roots otherwise.
+	Verify bool
+	CAFile string
+	CADir  string
+	// Format of certificate files, detected from the file when empty
+	Format string
+	// Password of PKCS#12 and Java keystores
+	Password string
+	// Recursive scanning of directories given as file locations
+	Recursive bool
+	// Include and Exclude are glob patterns matched against the names of files
+	// found in directories. Every file is included when Include is empty.
+	Include []string
+	Exclude []string
+	// KeyFile is the private key expected to match the leaf certificate,
+	// decrypted with Password when encrypted. It can only be set for
+	// locations holding a single certificate chain.
+	KeyFile string
+	// ClientCertFile and ClientKeyFile are presented to TLS servers that
+	// request a client certificate. The key defaults to the certificate file.
+	ClientCertFile string
+	ClientKeyFile  string
+	// ReportClientAuth reports the client certificate request of TLS servers
+	ReportClientAuth bool
+	// OCSP queries the leaf's OCSP responders for its revocation status
+	OCSP bool
+	// Staple reports the OCSP response stapled by TLS servers
+	Staple bool
+	// MustStaple is critical when a certificate with the OCSP Must-Staple
+	// extension is served without a staple
+	MustStaple bool
+	// CRL looks up the leaf in its issuer's CRL, read from CRLFile or from
+	// the leaf's distribution points
+	CRL     bool
+	CRLFile string
+	// SCT reports the signed certificate timestamps of the leaf, verified
+	// against the logs of CTLogList when set. Fewer than MinSCTs distinct
+	// logs is critical.
+	SCT       bool
+	CTLogList string
+	MinSCTs   int
+	// Strength evaluates the keys and signatures of the chain against the
+	// crypto policy, requiring RSA keys of at least MinRSABits
+	Strength   bool
+	MinRSABits int
+	// AuditTLS enumerates the protocol versions and cipher suites accepted
+	// by TLS servers. Accepting versions below MinTLSVersion is critical.
+	AuditTLS      bool
+	MinTLSVersion uint16
+	// Pins of which at least one must match a certificate of the chain
+	Pins []Pin
+	// Expect issuer, subject, names and organization of the leaf
+	Expect Expectations
 }
 
-// CollectMetrics Loads a certificate at a particular location and
-func CollectMetrics(ctx context.Context, path string, cfg Config) (Metrics, error) {
+// CollectMetrics Loads the certificates at a particular location and
+// evaluates every entry found there, each a chain of certificates leaf first.
+// TLS servers and certificate files hold a single entry, while scanned
+// directories, keystores, Secret manifests, kubeconfigs and bundles hold one
+// for every file, alias, key, user or chain. Checks of the leaf are evaluated
+// against the leaf of each entry.
+func CollectMetrics(ctx context.Context, path string, cfg Config) ([]Metrics, error) {
 	if cfg.Now == nil {
 		cfg.Now = time.Now
 	}
-	var metrics Metrics
-	certLoader, err := parse(path, cfg.ServerName)
+	certLoader, err := parse(path, cfg)
 	if err != nil {
-		return metrics, fmt.Errorf("error parsing cert location: %v", err)
+		var collectErr *CollectError
+		if errors.As(err, &collectErr) {
+			return nil, err
+		}
+		return nil, &CollectError{Reason: ReasonParse, Err: fmt.Errorf("error parsing cert location: %v", err)}
 	}
-	cert, err := certLoader(ctx)
+	loaded, err := certLoader(ctx)
 	if err != nil {
-		return metrics, err
+		return nil, err
+	}
+	if cfg.KeyFile != "" && len(loaded.entries) > 1 {
+		return nil, fmt.Errorf("private key %s can not be matched against the %d certificate chains of %s", cfg.KeyFile, len(loaded.entries), path)
+	}
+	var roots *x509.CertPool
+	if cfg.Verify {
+		if roots, err = loadRoots(cfg.CAFile, cfg.CADir); err != nil {
+			return nil, err
+		}
 	}
-	metrics.Tags = map[string]string{"subject": cert.Subject.CommonName}
+	var logs map[string]ctLogKey
+	if cfg.SCT && cfg.CTLogList != "" {
+		if logs, err = loadCTLogs(cfg.CTLogList); err != nil {
+			return nil, err
+		}
+	}
+	results := make([]Metrics, 0, len(loaded.entries))
+	for _, e := range loaded.entries {
+		metrics, err := evaluateEntry(ctx, e, loaded, cfg, roots, logs)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, metrics)
+	}
+	return results, nil
+}
+
+// evaluateEntry collects the metrics of a single entry of a location.
+func evaluateEntry(ctx context.Context, e entry, loaded *loadResult, cfg Config, roots *x509.CertPool, logs map[string]ctLogKey) (Metrics, error) {
+	var metrics Metrics
+	if e.err != nil {
+		metrics.EvaluatedAt = cfg.Now()
+		metrics.Tags = e.tags
+		metrics.Err = &CollectError{Reason: ReasonLoad, Err: e.err}
+		metrics.Findings = []Finding{{Status: StatusCritical, Message: e.err.Error()}}
+		return metrics, nil
+	}
+	chain := e.chain
+	cert := chain[0]
+	metrics.ClientAuth = loaded.clientAuth
+	metrics.Tags = mergeTags(map[string]string{"subject": cert.Subject.CommonName}, e.tags)
 	if cfg.ServerName != "" {
 		if err := cert.VerifyHostname(cfg.ServerName); err != nil {
 			return metrics, fmt.Errorf("error supplied servername not valid for this certificate: %v", err)
@@ -87,20 +221,168 @@ func CollectMetrics(ctx context.Context, path string, cfg Config) (Metrics, erro
 	metrics.EvaluatedAt = now
 	metrics.SecondsSinceIssued = int(now.Sub(cert.NotBefore).Seconds())
 	metrics.SecondsUntilExpires = int(cert.NotAfter.Sub(now).Seconds())
+	metrics.ChainMinSecondsUntilExpires = metrics.SecondsUntilExpires
+	for i, c := range chain {
+		cm := CertificateMetrics{
+			SecondsSinceIssued:  int(now.Sub(c.NotBefore).Seconds()),
+			SecondsUntilExpires: int(c.NotAfter.Sub(now).Seconds()),
+			Tags: mergeTags(map[string]string{
+				"index":   strconv.Itoa(i),
+				"subject": name(c.Subject),
+				"issuer":  name(c.Issuer),
+				"serial":  c.SerialNumber.Text(16),
+			}, e.tags),
+		}
+		if cm.SecondsUntilExpires < metrics.ChainMinSecondsUntilExpires {
+			metrics.ChainMinSecondsUntilExpires = cm.SecondsUntilExpires
+		}
+		metrics.Findings = append(metrics.Findings, evaluateExpiry(name(c.Subject), cm.SecondsUntilExpires, cfg)...)
+		if cfg.Strength {
+			var findings []Finding
+			cm.Strength, findings = evaluateStrength(c, i == 0, cfg.MinRSABits)
+			metrics.Findings = append(metrics.Findings, findings...)
+		}
+		metrics.Chain = append(metrics.Chain, cm)
+	}
+	if cfg.KeyFile != "" {
+		if key, err := loadPrivateKey(cfg.KeyFile, cfg.Password); err != nil {
+			metrics.Findings = append(metrics.Findings, Finding{
+				Status:  StatusCritical,
+				Message: fmt.Sprintf("could not load private key %s: %v", cfg.KeyFile, err),
+			})
+		} else {
+			match := keyMatches(cert, key)
+			metrics.KeyMatch = &match
+			if !match {
+				metrics.Findings = append(metrics.Findings, Finding{
+					Status:  StatusCritical,
+					Message: fmt.Sprintf("certificate %s does not match private key %s", name(cert.Subject), cfg.KeyFile),
+				})
+			}
+		}
+	}
+	var findings []Finding
+	metrics.Expectations, findings = evaluateExpectations(cert, cfg.Expect)
+	metrics.Findings = append(metrics.Findings, findings...)
+	if len(cfg.Pins) > 0 {
+		metrics.Pins = matchPins(chain, cfg.Pins)
+		metrics.Findings = append(metrics.Findings, evaluatePins(name(cert.Subject), metrics.Pins)...)
+	}
+	if cfg.OCSP {
+		metrics.OCSP = queryOCSP(ctx, chain)
+		metrics.Findings = append(metrics.Findings, evaluateOCSP(name(cert.Subject), "OCSP", metrics.OCSP, now)...)
+	}
+	if cfg.CRL {
+		metrics.CRL = checkCRL(ctx, chain, cfg.CRLFile)
+		metrics.Findings = append(metrics.Findings, evaluateCRL(name(cert.Subject), metrics.CRL, now)...)
+	}
+	if loaded.state != nil && (cfg.Staple || cfg.MustStaple) {
+		metrics.Staple = parseStaple(chain, loaded.state.OCSPResponse)
+		if metrics.Staple.Response != nil {
+			metrics.Findings = append(metrics.Findings, evaluateOCSP(name(cert.Subject), "OCSP staple", metrics.Staple.Response, now)...)
+		} else if cfg.MustStaple && mustStaple(cert) {
+			metrics.Findings = append(metrics.Findings, Finding{
+				Status:  StatusCritical,
+				Message: fmt.Sprintf("certificate %s requires OCSP stapling but no staple was served", name(cert.Subject)),
+			})
+		}
+	}
+	if cfg.SCT {
+		var tlsSCTs [][]byte
+		var staple []byte
+		if loaded.state != nil {
+			tlsSCTs = loaded.state.SignedCertificateTimestamps
+			staple = loaded.state.OCSPResponse
+		}
+		var findings []Finding
+		metrics.Transparency, findings = collectSCTs(chain, tlsSCTs, staple, logs)
+		metrics.Findings = append(metrics.Findings, findings...)
+		if metrics.Transparency.Logs < cfg.MinSCTs {
+			metrics.Findings = append(metrics.Findings, Finding{
+				Status:  StatusCritical,
+				Message: fmt.Sprintf("certificate %s has SCTs from %d logs, at least %d required", name(cert.Subject), metrics.Transparency.Logs, cfg.MinSCTs),
+			})
+		}
+	}
+	if loaded.audit != nil {
+		metrics.TLSAudit = loaded.audit
+		metrics.Findings = append(metrics.Findings, evaluateTLSAudit(loaded.audit, cfg.MinTLSVersion)...)
+	}
+	if cfg.Verify {
+		metrics.Verification = verifyChain(chain, roots, now)
+		if !metrics.Verification.Valid {
+			metrics.Findings = append(metrics.Findings, Finding{
+				Status:  StatusCritical,
+				Message: fmt.Sprintf("certificate chain verification failed: %v", metrics.Verification.Err),
+			})
+		}
+	}
 	return metrics, nil
 }
 
-func parse(cert, servername string) (certificateLoader, error) {
-	if strings.HasPrefix(cert, "file://") {
-		path := strings.TrimPrefix(cert, "file://")
-		info, err := os.Stat(path)
-		if err != nil {
-			return nil, fmt.Errorf("file not found: %s", path)
+// name of a certificate subject or issuer, preferring the common name.
+func name(n pkix.Name) string {
+	if n.CommonName != "" {
+		return n.CommonName
+	}
+	return n.String()
+}
+
+func evaluateExpiry(subject string, secondsLeft int, cfg Config) []Finding {
+	left := time.Duration(secondsLeft) * time.Second
+	switch {
+	case left < 0:
+		return []Finding{{
+			Status:  StatusCritical,
+			Message: fmt.Sprintf("certificate %s expired %s days ago", subject, formatDays(-left)),
+		}}
+	case cfg.Critical > 0 && left <= cfg.Critical:
+		return []Finding{{
+			Status:  StatusCritical,
+			Message: fmt.Sprintf("certificate %s expires in %s days (critical threshold %s days)", subject, formatDays(left), formatDays(cfg.Critical)),
+		}}
+	case cfg.Warning > 0 && left <= cfg.Warning:
+		return []Finding{{
+			Status:  StatusWarning,
+			Message: fmt.Sprintf("certificate %s expires in %s days (warning threshold %s days)", subject, formatDays(left), formatDays(cfg.Warning)),
+		}}
+	}
+	return nil
+}
+
+func formatDays(d time.Duration) string {
+	return fmt.Sprintf("%.1f", d.Seconds()/secondsToDays)
+}
+
+func parse(cert string, cfg Config) (certificateLoader, error) {
+	for prefix, format := range fileSchemes {
+		if !strings.HasPrefix(cert, prefix) {
+			continue
+		}
+		path := strings.TrimPrefix(cert, prefix)
+		if format == FormatAuto {
+			format = cfg.Format
+		}
+		switch format {
+		case FormatAuto, FormatPEM, FormatDER, FormatPKCS12, FormatJKS, FormatSecret, FormatKubeconfig:
+		default:
+			return nil, fmt.Errorf("unsupported certificate file format \"%s\"", format)
+		}
+		scan := hasGlobMeta(path)
+		if !scan {
+			info, err := os.Stat(path)
+			if err != nil {
+				return nil, &CollectError{Reason: ReasonLoad, Err: fmt.Errorf("file not found: %s", path)}
+			}
+			scan = info.IsDir()
+		}
+		if scan && cfg.KeyFile != "" {
+			return nil, fmt.Errorf("private key %s can not be matched against every file of %s", cfg.KeyFile, path)
 		}
-		if info.IsDir() {
-			return nil, fmt.Errorf("cannot use directory: %s", path)
+		if scan {
+			return fromScan(path, format, cfg), nil
 		}
-		return fromFile(path), nil
+		return fromFile(path, format, cfg.Password), nil
 	}
 
 	// Parse as network URL
@@ -109,23 +391,117 @@ func parse(cert, servername string) (certificateLoader, error) {
 		return nil, fmt.Errorf("error parsing certificate location as network url: %v", err)
 	}
 	switch certURL.Scheme {
-	case "https":
-		certURL.Scheme = "tcp"
+	case "https", "ldaps":
 		if certURL.Port() == "" {
-			certURL.Host = fmt.Sprintf("%s:443", certURL.Host)
+			certURL.Host = fmt.Sprintf("%s:%d", certURL.Host, implicitTLSPorts[certURL.Scheme])
 		}
+		certURL.Scheme = "tcp"
 		fallthrough
 	case "tcp", "tcp4", "tcp6":
-		return fromTLSHandshake(certURL, servername), nil
+		return fromTLSHandshake(certURL, cfg, nil), nil
 	default:
-		return nil, fmt.Errorf("unsupported certificate location scheme \"%s\" for %s", certURL.Scheme, cert)
+		upgrade, ok := starttlsUpgrades[certURL.Scheme]
+		if !ok {
+			return nil, fmt.Errorf("unsupported certificate location scheme \"%s\" for %s", certURL.Scheme, cert)
+		}
+		if certURL.Port() == "" {
+			certURL.Host = fmt.Sprintf("%s:%d", certURL.Host, upgrade.port)
+		}
+		certURL.Scheme = "tcp"
+		return fromTLSHandshake(certURL, cfg, upgrade.negotiate), nil
+	}
+}
+
+// implicitTLSPorts are the default ports of schemes that speak TLS from the
+// start of the connection.
+var implicitTLSPorts = map[string]int{
+	"https": 443,
+	"ldaps": 636,
+}
+
+// certificateLoader loads the certificate entries found at a location.
+type certificateLoader func(context.Context) (*loadResult, error)
+
+// loadResult of a certificateLoader.
+type loadResult struct {
+	// entries found at the location, in the order found
+	entries []entry
+	// clientAuth requested by a TLS server, when reported
+	clientAuth *ClientAuth
+	// state of the TLS connection, for network locations
+	state *tls.ConnectionState
+	// audit of the TLS versions and cipher suites, when requested
+	audit *TLSAudit
+}
+
+// entry is a certificate chain found at a location, leaf first.
+type entry struct {
+	chain []*x509.Certificate
+	// tags describing the entry, such as its file or keystore alias
+	tags map[string]string
+	// err is set instead of chain when the entry could not be loaded
+	err error
+}
+
+// chainEntries splits certificates into entries with splitChains. When there
+// is more than one, each is tagged with the serial of its leaf so that
+// entries with the same subject can be told apart.
+func chainEntries(certs []*x509.Certificate, tags map[string]string) []entry {
+	chains := splitChains(certs)
+	entries := make([]entry, 0, len(chains))
+	for _, chain := range chains {
+		e := entry{chain: chain, tags: tags}
+		if len(chains) > 1 {
+			e.tags = mergeTags(tags, map[string]string{"serial": chain[0].SerialNumber.Text(16)})
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// splitChains splits a list of certificates, such as a PEM bundle, into
+// chains. A chain continues while each certificate is the issuer of the one
+// before it, so a leaf followed by its intermediates stays a single chain
+// while a bundle of roots has a chain for every root.
+func splitChains(certs []*x509.Certificate) [][]*x509.Certificate {
+	var chains [][]*x509.Certificate
+	for i, c := range certs {
+		if i > 0 {
+			prev := certs[i-1]
+			selfSigned := bytes.Equal(prev.RawIssuer, prev.RawSubject)
+			if !selfSigned && bytes.Equal(prev.RawIssuer, c.RawSubject) {
+				chains[len(chains)-1] = append(chains[len(chains)-1], c)
+				continue
+			}
+		}
+		chains = append(chains, []*x509.Certificate{c})
 	}
+	return chains
 }
 
-type certificateLoader func(context.Context) (*x509.Certificate, error)
+// File formats supported by the file loader.
+const (
+	FormatAuto       = ""
+	FormatPEM        = "pem"
+	FormatDER        = "der"
+	FormatPKCS12     = "pkcs12"
+	FormatJKS        = "jks"
+	FormatSecret     = "secret"
+	FormatKubeconfig = "kubeconfig"
+)
+
+// fileSchemes map the prefixes of file locations to the file format they
+// imply. FormatAuto uses the configured format.
+var fileSchemes = map[string]string{
+	"file://":       FormatAuto,
+	"pkcs12://":     FormatPKCS12,
+	"jks://":        FormatJKS,
+	"secret://":     FormatSecret,
+	"kubeconfig://": FormatKubeconfig,
+}
 
-func fromFile(path string) certificateLoader {
-	return func(ctx context.Context) (*x509.Certificate, error) {
+func fromFile(path, format, password string) certificateLoader {
+	return func(ctx context.Context) (*loadResult, error) {
 		f, err := os.Open(path)
 		if err != nil {
 			return nil, fmt.Errorf("error opening certificate file: %v", err)
@@ -135,38 +511,179 @@ func fromFile(path string) certificateLoader {
 		if err != nil {
 			return nil, fmt.Errorf("error reading certificate file: %v", err)
 		}
-		block, _ := pem.Decode(data)
+		detected := format == FormatAuto
+		if detected {
+			format = detectFormat(path, data)
+		}
+		var certs []*x509.Certificate
+		switch format {
+		case FormatJKS:
+			return decodeJKS(data, password)
+		case FormatSecret:
+			return decodeSecrets(data)
+		case FormatKubeconfig:
+			return decodeKubeconfig(path, data)
+		case FormatPKCS12:
+			return decodePKCS12(data, password)
+		case FormatDER:
+			certs, err = decodeDER(data)
+			// any file that is not PEM is detected as DER, so only files
+			// named as certificates are expected to be one
+			if err != nil && detected && !derExtensions[strings.ToLower(filepath.Ext(path))] {
+				err = fmt.Errorf("%w: %v", errNoCertificates, err)
+			}
+		default:
+			certs, err = decodePEM(data)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &loadResult{entries: chainEntries(certs, nil)}, nil
+	}
+}
+
+// detectFormat of a certificate file from its extension and contents.
+func detectFormat(path string, data []byte) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".p12", ".pfx":
+		return FormatPKCS12
+	case ".yaml", ".yml", ".json":
+		return FormatSecret
+	}
+	if isJKS(data) {
+		return FormatJKS
+	}
+	if bytes.Contains(data, []byte("-----BEGIN")) {
+		return FormatPEM
+	}
+	return FormatDER
+}
+
+// decodeDER parses one or more concatenated DER certificates.
+func decodeDER(data []byte) ([]*x509.Certificate, error) {
+	chain, err := x509.ParseCertificates(data)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing DER encoded x509 certificate %v", err)
+	}
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("error decoding DER data from file")
+	}
+	return chain, nil
+}
+
+// derExtensions are the file extensions of DER encoded certificates.
+var derExtensions = map[string]bool{".der": true, ".cer": true, ".crt": true}
+
+// errNoCertificates is returned for files that hold no certificates, such as
+// private keys, configuration files or manifests without Secrets.
+var errNoCertificates = errors.New("no certificates found")
+
+// decodePEM parses every CERTIFICATE block in data.
+func decodePEM(data []byte) ([]*x509.Certificate, error) {
+	var chain []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
 		if block == nil {
-			return nil, fmt.Errorf("error decoding PEM data from file")
+			break
+		}
+		// skip private keys and other non certificate blocks
+		if block.Type != "CERTIFICATE" {
+			continue
 		}
 		result, err := x509.ParseCertificate(block.Bytes)
 		if err != nil {
 			return nil, fmt.Errorf("error parsing x509 certificate %v", err)
 		}
-		return result, nil
+		chain = append(chain, result)
+	}
+	// a certificate block that could not be decoded is left over
+	if len(chain) == 0 && bytes.Contains(data, []byte("CERTIFICATE-----")) {
+		return nil, fmt.Errorf("error decoding PEM data from file")
 	}
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("%w in PEM data", errNoCertificates)
+	}
+	return chain, nil
 }
 
-func fromTLSHandshake(target *url.URL, servername string) certificateLoader {
-	return func(ctx context.Context) (*x509.Certificate, error) {
+// fromTLSHandshake loads the chain presented by the server during a TLS
+// handshake. When negotiate is set it is run over the plaintext connection
+// before the handshake to upgrade the protocol to TLS.
+func fromTLSHandshake(target *url.URL, cfg Config, negotiate func(net.Conn) error) certificateLoader {
+	return func(ctx context.Context) (*loadResult, error) {
 		dialer := &net.Dialer{
 			Deadline: time.Now().Add(time.Second * 10),
 		}
 		if deadline, ok := ctx.Deadline(); ok {
 			dialer.Deadline = deadline
 		}
-		cfg := &tls.Config{InsecureSkipVerify: true}
-		if servername != "" {
-			cfg.ServerName = servername
+		var clientCert tls.Certificate
+		if cfg.ClientCertFile != "" {
+			var err error
+			if clientCert, err = loadClientCertificate(cfg.ClientCertFile, cfg.ClientKeyFile, cfg.Password); err != nil {
+				return nil, err
+			}
+		}
+		clientAuth := &ClientAuth{}
+		tlsCfg := &tls.Config{
+			InsecureSkipVerify: true,
+			GetClientCertificate: func(req *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				clientAuth.Requested = true
+				for _, ca := range req.AcceptableCAs {
+					clientAuth.AcceptableCAs = append(clientAuth.AcceptableCAs, distinguishedName(ca))
+				}
+				return &clientCert, nil
+			},
+		}
+		if cfg.ServerName != "" {
+			tlsCfg.ServerName = cfg.ServerName
+		} else {
+			tlsCfg.ServerName = target.Hostname()
 		}
-		conn, err := tls.DialWithDialer(dialer, target.Scheme, target.Host, cfg)
+		if cfg.AuditTLS {
+			// servers under audit may only accept legacy versions and suites
+			tlsCfg.MinVersion = tls.VersionTLS10
+			tlsCfg.CipherSuites = cipherSuitesFor(tls.VersionTLS12)
+		}
+		connect := func() (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, target.Scheme, target.Host)
+			if err != nil {
+				return nil, &CollectError{Reason: ReasonDial, Err: fmt.Errorf("error dialing TLS connection %w", err)}
+			}
+			if err := conn.SetDeadline(dialer.Deadline); err != nil {
+				conn.Close()
+				return nil, &CollectError{Reason: ReasonDial, Err: fmt.Errorf("error dialing TLS connection %w", err)}
+			}
+			if negotiate != nil {
+				if err := negotiate(conn); err != nil {
+					conn.Close()
+					return nil, &CollectError{Reason: ReasonHandshake, Err: fmt.Errorf("error negotiating TLS upgrade %w", err)}
+				}
+			}
+			return conn, nil
+		}
+		conn, err := connect()
 		if err != nil {
-			return nil, fmt.Errorf("error dialing TLS connection %v", err)
+			return nil, err
 		}
-		if err := conn.HandshakeContext(ctx); err != nil {
-			return nil, fmt.Errorf("error completing TLS handshake %v", err)
+		defer conn.Close()
+		tlsConn := tls.Client(conn, tlsCfg)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return nil, &CollectError{Reason: ReasonHandshake, Err: fmt.Errorf("error completing TLS handshake %w", err)}
 		}
-		state := conn.ConnectionState()
-		return state.PeerCertificates[0], nil
+		state := tlsConn.ConnectionState()
+		result := &loadResult{entries: []entry{{chain: state.PeerCertificates}}, state: &state}
+		if cfg.AuditTLS {
+			probeCfg := tlsCfg.Clone()
+			probeCfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				return &clientCert, nil
+			}
+			result.audit = auditTLS(ctx, connect, probeCfg)
+		}
+		if cfg.ReportClientAuth {
+			result.clientAuth = clientAuth
+		}
+		return result, nil
 	}
 }
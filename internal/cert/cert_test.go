@@ -3,6 +3,8 @@ package cert_test
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
 	"net"
 	"net/http"
 	"net/http/httptest"
@@ -126,7 +128,7 @@ func TestCollectMetricsFromFile(t *testing.T) {
 			ExpectErr: true,
 		},
 		{
-			Name: "Not a file",
+			Name: "directory holding a corrupt certificate",
 			Args: args{
 				Cert: "file://" + tmpDir,
 			},
@@ -136,7 +138,7 @@ func TestCollectMetricsFromFile(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.Name, func(t *testing.T) {
-			actual, err := cert.CollectMetrics(ctx, tc.Args.Cert, cert.Config{
+			actual, err := collectSingle(t, ctx, tc.Args.Cert, cert.Config{
 				Now:        tc.Args.Now,
 				ServerName: tc.Args.ServerName,
 			})
@@ -325,7 +327,7 @@ func TestCollectMetricsFromTLS(t *testing.T) {
 		t.Run(tc.Name, func(t *testing.T) {
 			ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
 			defer cancel()
-			actual, err := cert.CollectMetrics(ctx, tc.Args.Cert, cert.Config{
+			actual, err := collectSingle(t, ctx, tc.Args.Cert, cert.Config{
 				Now:        tc.Args.Now,
 				ServerName: tc.Args.ServerName,
 			})
@@ -353,6 +355,308 @@ func TestCollectMetricsFromTLS(t *testing.T) {
 	}
 }
 
+func TestCollectMetricsChain(t *testing.T) {
+	ctx := context.Background()
+
+	issuedAt := time.Unix(1<<30, 0)
+	root, _, err := testcert.New("root.sensu.io", issuedAt, time.Hour*96)
+	if err != nil {
+		t.Fatalf("could not create root certificate: %v", err)
+	}
+	intermediate, _, err := testcert.NewIssued("intermediate.sensu.io", issuedAt, time.Hour*48, root)
+	if err != nil {
+		t.Fatalf("could not create intermediate certificate: %v", err)
+	}
+	leaf, chainBytes, err := testcert.NewIssued("imposter.sensu.io", issuedAt, time.Hour*72, intermediate)
+	if err != nil {
+		t.Fatalf("could not create leaf certificate: %v", err)
+	}
+
+	chainPath := t.TempDir() + "/chain.pem"
+	if err := os.WriteFile(chainPath, chainBytes, 0644); err != nil {
+		t.Fatalf("could not write test certificate chain to file: %v", err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not start test server: %v", err)
+	}
+	srv := &http.Server{TLSConfig: &tls.Config{Certificates: []tls.Certificate{leaf}}}
+	go func() { _ = srv.ServeTLS(ln, "", "") }()
+	defer srv.Close()
+
+	expected := []cert.CertificateMetrics{
+		{
+			SecondsUntilExpires: int((time.Hour * 72).Seconds()),
+			Tags:                map[string]string{"index": "0", "subject": "imposter.sensu.io", "issuer": "intermediate.sensu.io", "serial": serial(t, leaf)},
+		}, {
+			SecondsUntilExpires: int((time.Hour * 48).Seconds()),
+			Tags:                map[string]string{"index": "1", "subject": "intermediate.sensu.io", "issuer": "root.sensu.io", "serial": serial(t, intermediate)},
+		}, {
+			SecondsUntilExpires: int((time.Hour * 96).Seconds()),
+			Tags:                map[string]string{"index": "2", "subject": "root.sensu.io", "issuer": "root.sensu.io", "serial": serial(t, root)},
+		},
+	}
+
+	for _, location := range []string{"file://" + chainPath, "tcp://" + ln.Addr().String()} {
+		t.Run(location, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+			defer cancel()
+			actual, err := collectSingle(t, ctx, location, cert.Config{
+				Now:     func() time.Time { return issuedAt },
+				Warning: time.Hour * 60,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(actual.Chain, expected) {
+				t.Errorf("expected Chain to be %v. actual: %v", expected, actual.Chain)
+			}
+			if actual.SecondsUntilExpires != int((time.Hour * 72).Seconds()) {
+				t.Errorf("expected leaf SecondsUntilExpires to be: %d. actual: %d", int((time.Hour * 72).Seconds()), actual.SecondsUntilExpires)
+			}
+			if actual.ChainMinSecondsUntilExpires != int((time.Hour * 48).Seconds()) {
+				t.Errorf("expected ChainMinSecondsUntilExpires to be: %d. actual: %d", int((time.Hour * 48).Seconds()), actual.ChainMinSecondsUntilExpires)
+			}
+			if actual.Status() != cert.StatusWarning {
+				t.Errorf("expected expiring intermediate to produce a warning. actual: %s", actual.Status())
+			}
+		})
+	}
+}
+
+func TestCollectMetricsFromBundle(t *testing.T) {
+	ctx := context.Background()
+
+	issuedAt := time.Unix(1<<30, 0)
+	first, firstBytes, err := testcert.New("first.sensu.io", issuedAt, time.Hour*72)
+	if err != nil {
+		t.Fatalf("could not create certificate: %v", err)
+	}
+	second, secondBytes, err := testcert.New("second.sensu.io", issuedAt, time.Hour*24)
+	if err != nil {
+		t.Fatalf("could not create certificate: %v", err)
+	}
+	params := pem.EncodeToMemory(&pem.Block{Type: "DH PARAMETERS", Bytes: []byte{0x30, 0x00}})
+
+	var bundle []byte
+	bundle = append(bundle, testcert.SigningKey...)
+	bundle = append(bundle, firstBytes...)
+	bundle = append(bundle, "# comment between blocks\n"...)
+	bundle = append(bundle, params...)
+	bundle = append(bundle, secondBytes...)
+	bundlePath := t.TempDir() + "/bundle.pem"
+	if err := os.WriteFile(bundlePath, bundle, 0644); err != nil {
+		t.Fatalf("could not write bundle to file: %v", err)
+	}
+
+	actual, err := cert.CollectMetrics(ctx, "file://"+bundlePath, cert.Config{
+		Now: func() time.Time { return issuedAt },
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	// unrelated certificates are separate entries, told apart by serial
+	expected := [][]cert.CertificateMetrics{
+		{{
+			SecondsUntilExpires: int((time.Hour * 72).Seconds()),
+			Tags:                map[string]string{"index": "0", "subject": "first.sensu.io", "issuer": "first.sensu.io", "serial": serial(t, first)},
+		}}, {{
+			SecondsUntilExpires: int((time.Hour * 24).Seconds()),
+			Tags:                map[string]string{"index": "0", "subject": "second.sensu.io", "issuer": "second.sensu.io", "serial": serial(t, second)},
+		}},
+	}
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %d entries. actual: %d", len(expected), len(actual))
+	}
+	for i, m := range actual {
+		if !reflect.DeepEqual(m.Chain, expected[i]) {
+			t.Errorf("expected entry %d Chain to be %v. actual: %v", i, expected[i], m.Chain)
+		}
+		if m.Tags["serial"] != expected[i][0].Tags["serial"] {
+			t.Errorf("expected entry %d to be tagged with serial %s. actual: %v", i, expected[i][0].Tags["serial"], m.Tags)
+		}
+	}
+
+	keyOnlyPath := t.TempDir() + "/key.pem"
+	if err := os.WriteFile(keyOnlyPath, testcert.SigningKey, 0644); err != nil {
+		t.Fatalf("could not write key to file: %v", err)
+	}
+	if _, err := collectSingle(t, ctx, "file://"+keyOnlyPath, cert.Config{}); err == nil {
+		t.Error("expected error for file without certificates")
+	}
+}
+
+func TestCollectMetricsFromDER(t *testing.T) {
+	ctx := context.Background()
+
+	issuedAt := time.Unix(1<<30, 0)
+	duration := time.Hour * 72
+	root, _, err := testcert.New("root.sensu.io", issuedAt, duration)
+	if err != nil {
+		t.Fatalf("could not create root certificate: %v", err)
+	}
+	leaf, pemBytes, err := testcert.NewIssued("imposter.sensu.io", issuedAt, duration, root)
+	if err != nil {
+		t.Fatalf("could not create leaf certificate: %v", err)
+	}
+
+	_, certBytes, err := testcert.New("imposter.sensu.io", issuedAt, duration)
+	if err != nil {
+		t.Fatalf("could not create certificate: %v", err)
+	}
+	block, _ := pem.Decode(certBytes)
+
+	tmpDir := t.TempDir()
+	derPath := tmpDir + "/testcert.der"
+	if err := os.WriteFile(derPath, block.Bytes, 0644); err != nil {
+		t.Fatalf("could not write DER certificate to file: %v", err)
+	}
+	derChainPath := tmpDir + "/chain.cer"
+	if err := os.WriteFile(derChainPath, append(append([]byte{}, leaf.Certificate[0]...), leaf.Certificate[1]...), 0644); err != nil {
+		t.Fatalf("could not write DER certificate chain to file: %v", err)
+	}
+	pemPath := tmpDir + "/chain.pem"
+	if err := os.WriteFile(pemPath, pemBytes, 0644); err != nil {
+		t.Fatalf("could not write PEM certificate chain to file: %v", err)
+	}
+	corruptPath := tmpDir + "/corrupt.der"
+	if err := os.WriteFile(corruptPath, leaf.Certificate[0][:len(leaf.Certificate[0])/2], 0644); err != nil {
+		t.Fatalf("could not write corrupted DER certificate to file: %v", err)
+	}
+
+	testCases := []struct {
+		Name      string
+		Path      string
+		Format    string
+		ChainLen  int
+		ExpectErr bool
+	}{
+		{Name: "detected DER", Path: derPath, ChainLen: 1},
+		{Name: "detected DER chain", Path: derChainPath, ChainLen: 2},
+		{Name: "explicit DER", Path: derPath, Format: cert.FormatDER, ChainLen: 1},
+		{Name: "detected PEM", Path: pemPath, ChainLen: 2},
+		{Name: "explicit PEM", Path: pemPath, Format: cert.FormatPEM, ChainLen: 2},
+		{Name: "DER file as PEM", Path: derPath, Format: cert.FormatPEM, ExpectErr: true},
+		{Name: "PEM file as DER", Path: pemPath, Format: cert.FormatDER, ExpectErr: true},
+		{Name: "corrupted DER", Path: corruptPath, ExpectErr: true},
+		{Name: "unsupported format", Path: derPath, Format: "p7b", ExpectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			actual, err := collectSingle(t, ctx, "file://"+tc.Path, cert.Config{
+				Now:    func() time.Time { return issuedAt },
+				Format: tc.Format,
+			})
+			if err != nil && !tc.ExpectErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if err != nil {
+				return
+			}
+			if tc.ExpectErr {
+				t.Fatal("expected error")
+			}
+			if len(actual.Chain) != tc.ChainLen {
+				t.Errorf("expected %d certificates. actual: %d", tc.ChainLen, len(actual.Chain))
+			}
+			if actual.Tags["subject"] != "imposter.sensu.io" {
+				t.Errorf("expected subject imposter.sensu.io. actual: %s", actual.Tags["subject"])
+			}
+			if actual.SecondsUntilExpires != int(duration.Seconds()) {
+				t.Errorf("expected SecondsUntilExpires to be: %d. actual: %d", int(duration.Seconds()), actual.SecondsUntilExpires)
+			}
+		})
+	}
+}
+
+func TestCollectMetricsThresholds(t *testing.T) {
+	ctx := context.Background()
+
+	issuedAt := time.Unix(1<<30, 0)
+	duration := time.Hour * 24 * 90
+	_, certBytes, err := testcert.New("imposter.sensu.io", issuedAt, duration)
+	if err != nil {
+		t.Fatalf("could not load testcert as x509 key pair: %v", err)
+	}
+	testCertPath := t.TempDir() + "/testcert.pem"
+	if err := os.WriteFile(testCertPath, certBytes, 0644); err != nil {
+		t.Fatalf("could not write test certificate to file: %v", err)
+	}
+
+	daysBeforeExpiration := func(days int) func() time.Time {
+		return func() time.Time {
+			return issuedAt.Add(duration).Add(time.Duration(-days) * time.Hour * 24)
+		}
+	}
+
+	testCases := []struct {
+		Name     string
+		Now      func() time.Time
+		Warning  time.Duration
+		Critical time.Duration
+		Expected cert.Status
+	}{
+		{
+			Name:     "no thresholds",
+			Now:      daysBeforeExpiration(1),
+			Expected: cert.StatusOK,
+		}, {
+			Name:     "outside thresholds",
+			Now:      daysBeforeExpiration(60),
+			Warning:  time.Hour * 24 * 30,
+			Critical: time.Hour * 24 * 7,
+			Expected: cert.StatusOK,
+		}, {
+			Name:     "within warning threshold",
+			Now:      daysBeforeExpiration(20),
+			Warning:  time.Hour * 24 * 30,
+			Critical: time.Hour * 24 * 7,
+			Expected: cert.StatusWarning,
+		}, {
+			Name:     "within critical threshold",
+			Now:      daysBeforeExpiration(5),
+			Warning:  time.Hour * 24 * 30,
+			Critical: time.Hour * 24 * 7,
+			Expected: cert.StatusCritical,
+		}, {
+			Name:     "expired without thresholds",
+			Now:      daysBeforeExpiration(-1),
+			Expected: cert.StatusCritical,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			actual, err := collectSingle(t, ctx, "file://"+testCertPath, cert.Config{
+				Now:      tc.Now,
+				Warning:  tc.Warning,
+				Critical: tc.Critical,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if actual.Status() != tc.Expected {
+				t.Errorf("expected status %s. actual: %s %v", tc.Expected, actual.Status(), actual.Findings)
+			}
+			if tc.Expected != cert.StatusOK && len(actual.Findings) == 0 {
+				t.Error("expected findings describing the status")
+			}
+		})
+	}
+}
+
+// serial of the leaf of keyPair as reported in metric tags
+func serial(t *testing.T, keyPair tls.Certificate) string {
+	t.Helper()
+	c, err := x509.ParseCertificate(keyPair.Certificate[0])
+	if err != nil {
+		t.Fatalf("could not parse certificate: %v", err)
+	}
+	return c.SerialNumber.Text(16)
+}
+
 type args struct {
 	Cert       string
 	ServerName string
@@ -365,3 +669,80 @@ type testCase struct {
 	Expected  *cert.Metrics
 	ExpectErr bool
 }
+
+func TestErrorReason(t *testing.T) {
+	// a port nothing listens on
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	closed := ln.Addr().String()
+	ln.Close()
+
+	// a server that hangs up without speaking TLS
+	plain, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	defer plain.Close()
+	go func() {
+		for {
+			conn, err := plain.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = conn.Write([]byte("220 not TLS\r\n"))
+			conn.Close()
+		}
+	}()
+
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	testCases := []struct {
+		Name     string
+		Ctx      context.Context
+		Location string
+		Expected string
+	}{
+		{Name: "unsupported scheme", Location: "gopher://sensu.io", Expected: cert.ReasonParse},
+		{Name: "missing file", Location: "file:///does/not/exist.pem", Expected: cert.ReasonLoad},
+		{Name: "connection refused", Location: "tcp://" + closed, Expected: cert.ReasonDial},
+		{Name: "not TLS", Location: "tcp://" + plain.Addr().String(), Expected: cert.ReasonHandshake},
+		{Name: "deadline exceeded", Ctx: expired, Location: "tcp://" + plain.Addr().String(), Expected: cert.ReasonTimeout},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			ctx := tc.Ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			_, err := cert.CollectMetrics(ctx, tc.Location, cert.Config{})
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if reason := cert.ErrorReason(err); reason != tc.Expected {
+				t.Errorf("expected reason %s. actual: %s (%v)", tc.Expected, reason, err)
+			}
+		})
+	}
+}
+
+// collectSingle collects a location that holds a single entry, returning the
+// error of any entry that could not be loaded.
+func collectSingle(t *testing.T, ctx context.Context, location string, cfg cert.Config) (cert.Metrics, error) {
+	t.Helper()
+	results, err := cert.CollectMetrics(ctx, location, cfg)
+	if err != nil {
+		return cert.Metrics{}, err
+	}
+	for _, m := range results {
+		if m.Err != nil {
+			return cert.Metrics{}, m.Err
+		}
+	}
+	if len(results) != 1 {
+		t.Fatalf("expected a single entry at %s. actual: %d", location, len(results))
+	}
+	return results[0], nil
+}
@@ -0,0 +1,61 @@
+package cert
+
+import (
+	"crypto/tls"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"os"
+)
+
+// ClientAuth describes the client certificate request of a TLS server.
+type ClientAuth struct {
+	// Requested is set when the server asked for a client certificate
+	Requested bool
+	// AcceptableCAs are the distinguished names of the certificate
+	// authorities the server accepts client certificates from. Empty when the
+	// server accepts any.
+	AcceptableCAs []string
+}
+
+// loadClientCertificate reads a PEM encoded client certificate chain and its
+// private key, which may be encrypted with password.
+func loadClientCertificate(certFile, keyFile, password string) (tls.Certificate, error) {
+	var clientCert tls.Certificate
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		return clientCert, fmt.Errorf("error reading client certificate file: %v", err)
+	}
+	chain, err := decodePEM(data)
+	if err != nil {
+		return clientCert, fmt.Errorf("error loading client certificate: %v", err)
+	}
+	if keyFile == "" {
+		keyFile = certFile
+	}
+	key, err := loadPrivateKey(keyFile, password)
+	if err != nil {
+		return clientCert, fmt.Errorf("error loading client key: %v", err)
+	}
+	if !keyMatches(chain[0], key) {
+		return clientCert, fmt.Errorf("client certificate does not match client key")
+	}
+	for _, c := range chain {
+		clientCert.Certificate = append(clientCert.Certificate, c.Raw)
+	}
+	clientCert.PrivateKey = key
+	clientCert.Leaf = chain[0]
+	return clientCert, nil
+}
+
+// distinguishedName formats a DER encoded distinguished name from a
+// certificate request, falling back to hex for malformed names.
+func distinguishedName(der []byte) string {
+	var rdns pkix.RDNSequence
+	if rest, err := asn1.Unmarshal(der, &rdns); err != nil || len(rest) > 0 {
+		return fmt.Sprintf("%x", der)
+	}
+	var n pkix.Name
+	n.FillFromRDNSequence(&rdns)
+	return n.String()
+}
@@ -0,0 +1,98 @@
+package cert_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sensu/cert-checks/internal/cert"
+	"github.com/sensu/cert-checks/internal/cert/testcert"
+)
+
+func TestCollectMetricsClientAuth(t *testing.T) {
+	ctx := context.Background()
+
+	issuedAt := time.Now().Add(-time.Hour)
+	duration := time.Hour * 72
+	serverPair, _, err := testcert.New("mtls.sensu.io", issuedAt, duration)
+	if err != nil {
+		t.Fatalf("could not create server certificate: %v", err)
+	}
+	ca, _, err := testcert.New("client-ca.sensu.io", issuedAt, duration)
+	if err != nil {
+		t.Fatalf("could not create client CA: %v", err)
+	}
+	clientPair, clientBytes, err := testcert.NewIssued("client.sensu.io", issuedAt, duration, ca)
+	if err != nil {
+		t.Fatalf("could not create client certificate: %v", err)
+	}
+	clientKey, err := x509.MarshalPKCS8PrivateKey(clientPair.PrivateKey)
+	if err != nil {
+		t.Fatalf("could not marshal client key: %v", err)
+	}
+	dir := t.TempDir()
+	clientCertPath := filepath.Join(dir, "client.crt")
+	if err := os.WriteFile(clientCertPath, clientBytes, 0644); err != nil {
+		t.Fatalf("could not write client certificate: %v", err)
+	}
+	clientKeyPath := filepath.Join(dir, "client.key")
+	if err := os.WriteFile(clientKeyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: clientKey}), 0600); err != nil {
+		t.Fatalf("could not write client key: %v", err)
+	}
+
+	caCert, err := x509.ParseCertificate(ca.Certificate[0])
+	if err != nil {
+		t.Fatalf("could not parse client CA: %v", err)
+	}
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(caCert)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverPair},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+		// TLS 1.2 fails the client handshake when the certificate is rejected
+		MaxVersion: tls.VersionTLS12,
+	}
+	srv.StartTLS()
+	defer srv.Close()
+	target := "tcp://" + srv.Listener.Addr().String()
+
+	if _, err := collectSingle(t, ctx, target, cert.Config{}); err == nil {
+		t.Error("expected handshake error without client certificate")
+	}
+
+	actual, err := collectSingle(t, ctx, target, cert.Config{
+		ClientCertFile:   clientCertPath,
+		ClientKeyFile:    clientKeyPath,
+		ReportClientAuth: true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if actual.Tags["subject"] != "mtls.sensu.io" {
+		t.Errorf("expected subject mtls.sensu.io. actual: %s", actual.Tags["subject"])
+	}
+	expected := &cert.ClientAuth{
+		Requested:     true,
+		AcceptableCAs: []string{"CN=client-ca.sensu.io,OU=Sensu Test,O=Sumo Logic Inc"},
+	}
+	if !reflect.DeepEqual(actual.ClientAuth, expected) {
+		t.Errorf("expected ClientAuth to be %v. actual: %v", expected, actual.ClientAuth)
+	}
+
+	if _, err := collectSingle(t, ctx, target, cert.Config{
+		ClientCertFile: clientCertPath,
+		ClientKeyFile:  filepath.Join(dir, "missing.key"),
+	}); err == nil {
+		t.Error("expected error for missing client key")
+	}
+}
@@ -0,0 +1,135 @@
+package cert
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// maxCRLSize bounds the CRLs read from distribution points.
+const maxCRLSize = 32 << 20
+
+// CRLStatus of the leaf certificate according to its issuer's CRL.
+type CRLStatus struct {
+	// Revoked is set when the CRL lists the certificate serial
+	Revoked   bool
+	RevokedAt time.Time
+	// NextUpdate is when the CRL is due to be replaced
+	NextUpdate time.Time
+	// Err is set when no valid CRL was obtained
+	Err error
+}
+
+// checkCRL looks up the leaf in the CRL read from crlFile or, when crlFile is
+// empty, fetched from the leaf's http and file distribution points. The CRL
+// must be signed by the issuer from the chain.
+func checkCRL(ctx context.Context, chain []*x509.Certificate, crlFile string) *CRLStatus {
+	leaf := chain[0]
+	issuer, err := findIssuer(chain)
+	if err != nil {
+		return &CRLStatus{Err: err}
+	}
+	locations := leaf.CRLDistributionPoints
+	if crlFile != "" {
+		locations = []string{crlFile}
+	}
+	err = fmt.Errorf("certificate has no CRL distribution point")
+	for _, location := range locations {
+		var crl *pkix.CertificateList
+		if crl, err = loadCRL(ctx, location, crlFile != ""); err != nil {
+			continue
+		}
+		if err = issuer.CheckCRLSignature(crl); err != nil {
+			err = fmt.Errorf("invalid CRL signature from %s: %v", location, err)
+			continue
+		}
+		status := &CRLStatus{NextUpdate: crl.TBSCertList.NextUpdate}
+		for _, revoked := range crl.TBSCertList.RevokedCertificates {
+			if revoked.SerialNumber.Cmp(leaf.SerialNumber) == 0 {
+				status.Revoked = true
+				status.RevokedAt = revoked.RevocationTime
+				break
+			}
+		}
+		return status
+	}
+	return &CRLStatus{Err: err}
+}
+
+// loadCRL reads a PEM or DER encoded CRL from a local file, or from an http
+// or file URL.
+func loadCRL(ctx context.Context, location string, local bool) (*pkix.CertificateList, error) {
+	var data []byte
+	var err error
+	if local {
+		data, err = os.ReadFile(location)
+	} else {
+		data, err = fetchCRL(ctx, location)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading CRL from %s: %v", location, err)
+	}
+	crl, err := x509.ParseCRL(data)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing CRL from %s: %v", location, err)
+	}
+	return crl, nil
+}
+
+func fetchCRL(ctx context.Context, location string) ([]byte, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "file":
+		return os.ReadFile(u.Path)
+	case "http", "https":
+	default:
+		return nil, fmt.Errorf("unsupported distribution point scheme %q", u.Scheme)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxCRLSize))
+}
+
+// evaluateCRL reports revoked certificates, expired CRLs and failures to
+// obtain a CRL.
+func evaluateCRL(subject string, s *CRLStatus, now time.Time) []Finding {
+	if s.Err != nil {
+		return []Finding{{
+			Status:  StatusWarning,
+			Message: fmt.Sprintf("CRL check failed: %v", s.Err),
+		}}
+	}
+	var findings []Finding
+	if s.Revoked {
+		findings = append(findings, Finding{
+			Status:  StatusCritical,
+			Message: fmt.Sprintf("certificate %s was revoked at %s", subject, s.RevokedAt.UTC().Format(time.RFC3339)),
+		})
+	}
+	if !s.NextUpdate.IsZero() && s.NextUpdate.Before(now) {
+		findings = append(findings, Finding{
+			Status:  StatusWarning,
+			Message: fmt.Sprintf("CRL for certificate %s expired at %s", subject, s.NextUpdate.UTC().Format(time.RFC3339)),
+		})
+	}
+	return findings
+}
@@ -0,0 +1,175 @@
+package cert_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sensu/cert-checks/internal/cert"
+	"github.com/sensu/cert-checks/internal/cert/testcert"
+)
+
+func TestCollectMetricsCRL(t *testing.T) {
+	ctx := context.Background()
+
+	issuedAt := time.Unix(1<<30, 0)
+	duration := time.Hour * 72
+	ca, _, err := testcert.New("ca.sensu.io", issuedAt, duration, func(c *x509.Certificate) {
+		c.KeyUsage |= x509.KeyUsageCRLSign
+	})
+	if err != nil {
+		t.Fatalf("could not create CA certificate: %v", err)
+	}
+	caCert, err := x509.ParseCertificate(ca.Certificate[0])
+	if err != nil {
+		t.Fatalf("could not parse CA certificate: %v", err)
+	}
+	_, imposterKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate key: %v", err)
+	}
+
+	dir := t.TempDir()
+	var revoked []pkix.RevokedCertificate
+	writeCRL := func(name string, signer ed25519.PrivateKey) string {
+		der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+			Number:              big.NewInt(1),
+			ThisUpdate:          issuedAt,
+			NextUpdate:          issuedAt.Add(time.Hour * 24),
+			RevokedCertificates: revoked,
+		}, caCert, signer)
+		if err != nil {
+			t.Fatalf("could not create CRL: %v", err)
+		}
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, der, 0644); err != nil {
+			t.Fatalf("could not write CRL: %v", err)
+		}
+		return path
+	}
+	issue := func(host string, revoke bool, distributionPoints ...string) string {
+		pair, chainBytes, err := testcert.NewIssued(host, issuedAt, duration, ca, func(c *x509.Certificate) {
+			c.CRLDistributionPoints = distributionPoints
+		})
+		if err != nil {
+			t.Fatalf("could not create certificate: %v", err)
+		}
+		if revoke {
+			leaf, err := x509.ParseCertificate(pair.Certificate[0])
+			if err != nil {
+				t.Fatalf("could not parse certificate: %v", err)
+			}
+			revoked = append(revoked, pkix.RevokedCertificate{SerialNumber: leaf.SerialNumber, RevocationTime: issuedAt.Add(time.Hour)})
+		}
+		path := filepath.Join(dir, host+".pem")
+		if err := os.WriteFile(path, chainBytes, 0644); err != nil {
+			t.Fatalf("could not write certificate: %v", err)
+		}
+		return "file://" + path
+	}
+
+	crlPath := filepath.Join(dir, "ca.crl")
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		http.ServeFile(rw, r, crlPath)
+	}))
+	defer srv.Close()
+
+	good := issue("good.sensu.io", false, "ldap://ldap.sensu.io/cn=ca", srv.URL+"/ca.crl")
+	fromFileURL := issue("file.sensu.io", false, "file://"+crlPath)
+	revokedCert := issue("revoked.sensu.io", true, srv.URL+"/ca.crl")
+	noDistributionPoint := issue("none.sensu.io", false)
+	writeCRL("ca.crl", ca.PrivateKey.(ed25519.PrivateKey))
+	imposterCRL := writeCRL("imposter.crl", imposterKey)
+
+	testCases := []struct {
+		Name           string
+		Cert           string
+		CRLFile        string
+		Now            time.Time
+		ExpectedStatus cert.Status
+		ExpectRevoked  bool
+		ExpectErr      bool
+	}{
+		{
+			Name:           "http distribution point",
+			Cert:           good,
+			Now:            issuedAt,
+			ExpectedStatus: cert.StatusOK,
+		}, {
+			Name:           "file distribution point",
+			Cert:           fromFileURL,
+			Now:            issuedAt,
+			ExpectedStatus: cert.StatusOK,
+		}, {
+			Name:           "revoked",
+			Cert:           revokedCert,
+			Now:            issuedAt,
+			ExpectedStatus: cert.StatusCritical,
+			ExpectRevoked:  true,
+		}, {
+			Name:           "expired CRL",
+			Cert:           good,
+			Now:            issuedAt.Add(time.Hour * 48),
+			ExpectedStatus: cert.StatusWarning,
+		}, {
+			Name:           "crl file",
+			Cert:           noDistributionPoint,
+			CRLFile:        crlPath,
+			Now:            issuedAt,
+			ExpectedStatus: cert.StatusOK,
+		}, {
+			Name:           "crl file revoked",
+			Cert:           revokedCert,
+			CRLFile:        crlPath,
+			Now:            issuedAt,
+			ExpectedStatus: cert.StatusCritical,
+			ExpectRevoked:  true,
+		}, {
+			Name:           "invalid signature",
+			Cert:           good,
+			CRLFile:        imposterCRL,
+			Now:            issuedAt,
+			ExpectedStatus: cert.StatusWarning,
+			ExpectErr:      true,
+		}, {
+			Name:           "no distribution point",
+			Cert:           noDistributionPoint,
+			Now:            issuedAt,
+			ExpectedStatus: cert.StatusWarning,
+			ExpectErr:      true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			actual, err := collectSingle(t, ctx, tc.Cert, cert.Config{
+				Now:     func() time.Time { return tc.Now },
+				CRL:     true,
+				CRLFile: tc.CRLFile,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if actual.CRL == nil {
+				t.Fatal("expected CRL status")
+			}
+			if tc.ExpectErr != (actual.CRL.Err != nil) {
+				t.Errorf("unexpected CRL error %v", actual.CRL.Err)
+			}
+			if actual.CRL.Revoked != tc.ExpectRevoked {
+				t.Errorf("expected Revoked to be %v. actual: %v", tc.ExpectRevoked, actual.CRL.Revoked)
+			}
+			if status := actual.Status(); status != tc.ExpectedStatus {
+				t.Errorf("expected status %v. actual: %v (%v)", tc.ExpectedStatus, status, actual.Findings)
+			}
+		})
+	}
+}
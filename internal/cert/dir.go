@@ -0,0 +1,151 @@
+package cert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// hasGlobMeta reports whether path contains glob pattern characters.
+func hasGlobMeta(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// fromScan loads the certificates of every file found in a directory or
+// matching a glob pattern, tagging each entry with its file. Files that do not
+// hold certificates, such as private keys, READMEs or configuration files, are
+// skipped while certificate files that fail to load are reported as entries
+// with an error.
+func fromScan(pattern, format string, cfg Config) certificateLoader {
+	return func(ctx context.Context) (*loadResult, error) {
+		files, err := scanFiles(pattern, cfg.Recursive, cfg.Include, cfg.Exclude)
+		if err != nil {
+			return nil, err
+		}
+		result := &loadResult{}
+		for _, file := range files {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			loaded, err := fromFile(file, format, cfg.Password)(ctx)
+			if errors.Is(err, errNoCertificates) {
+				continue
+			}
+			if err != nil {
+				result.entries = append(result.entries, entry{
+					tags: map[string]string{"file": file},
+					err:  fmt.Errorf("error loading %s: %v", file, err),
+				})
+				continue
+			}
+			for _, e := range loaded.entries {
+				e.tags = mergeTags(e.tags, map[string]string{"file": file})
+				result.entries = append(result.entries, e)
+			}
+		}
+		if len(result.entries) == 0 {
+			return nil, fmt.Errorf("no certificates found in %s", pattern)
+		}
+		return result, nil
+	}
+}
+
+// scanFiles lists the files in a directory, or in the files and directories
+// matching a glob pattern, in lexical order. Directories are only descended
+// into when recursive is set. Files reached through symlinks are only listed
+// once, by their own path when it was found too.
+func scanFiles(pattern string, recursive bool, include, exclude []string) ([]string, error) {
+	roots := []string{pattern}
+	if hasGlobMeta(pattern) {
+		var err error
+		if roots, err = filepath.Glob(pattern); err != nil {
+			return nil, fmt.Errorf("invalid file pattern %s: %v", pattern, err)
+		}
+		if len(roots) == 0 {
+			return nil, fmt.Errorf("no files match %s", pattern)
+		}
+	}
+
+	// seen maps resolved paths to their index in files
+	seen := map[string]int{}
+	var files []string
+	add := func(path string) {
+		if !matchName(filepath.Base(path), include, exclude) {
+			return
+		}
+		resolved, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			return
+		}
+		if i, ok := seen[resolved]; ok {
+			// prefer the file itself over symlinks to it
+			if info, err := os.Lstat(path); err == nil && info.Mode()&fs.ModeSymlink == 0 {
+				files[i] = path
+			}
+			return
+		}
+		seen[resolved] = len(files)
+		files = append(files, path)
+	}
+	for _, root := range roots {
+		info, err := os.Stat(root)
+		if err != nil {
+			continue
+		}
+		if !info.IsDir() {
+			add(root)
+			continue
+		}
+		if root, err = filepath.EvalSymlinks(root); err != nil {
+			continue
+		}
+		_ = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				// skip unreadable entries
+				return nil
+			}
+			if d.IsDir() {
+				if path != root && !recursive {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.Type()&fs.ModeSymlink != 0 {
+				// symlinked directories are not followed
+				if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+					return nil
+				}
+			} else if !d.Type().IsRegular() {
+				return nil
+			}
+			add(path)
+			return nil
+		})
+	}
+	return files, nil
+}
+
+// matchName reports whether a file name matches any include pattern and no
+// exclude pattern. Every name is included when there are no include patterns.
+func matchName(name string, include, exclude []string) bool {
+	included := len(include) == 0
+	for _, pattern := range include {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			included = true
+			break
+		}
+	}
+	if !included {
+		return false
+	}
+	for _, pattern := range exclude {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,187 @@
+package cert_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sensu/cert-checks/internal/cert"
+	"github.com/sensu/cert-checks/internal/cert/testcert"
+)
+
+func TestCollectMetricsFromDirectory(t *testing.T) {
+	ctx := context.Background()
+
+	issuedAt := time.Unix(1<<30, 0)
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("could not create directory: %v", err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatalf("could not write %s: %v", name, err)
+		}
+		return path
+	}
+	var certBytes []byte
+	for _, host := range []string{"a", "b", "sub/c"} {
+		var err error
+		_, certBytes, err = testcert.New(filepath.Base(host)+".sensu.io", issuedAt, time.Hour*72)
+		if err != nil {
+			t.Fatalf("could not create certificate: %v", err)
+		}
+		write(host+".pem", certBytes)
+	}
+	write("privkey.pem", testcert.SigningKey)
+	if err := os.Symlink(filepath.Join(dir, "a.pem"), filepath.Join(dir, "a.0")); err != nil {
+		t.Fatalf("could not create symlink: %v", err)
+	}
+
+	testCases := []struct {
+		Name     string
+		Location string
+		Config   cert.Config
+		Expected []string
+	}{
+		{
+			Name:     "directory",
+			Location: dir,
+			Expected: []string{"a.pem", "b.pem"},
+		}, {
+			Name:     "recursive",
+			Location: dir,
+			Config:   cert.Config{Recursive: true},
+			Expected: []string{"a.pem", "b.pem", "sub/c.pem"},
+		}, {
+			Name:     "include and exclude",
+			Location: dir,
+			Config:   cert.Config{Recursive: true, Include: []string{"*.pem"}, Exclude: []string{"b.*"}},
+			Expected: []string{"a.pem", "sub/c.pem"},
+		}, {
+			Name:     "glob",
+			Location: filepath.Join(dir, "*", "*.pem"),
+			Expected: []string{"sub/c.pem"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			tc.Config.Now = func() time.Time { return issuedAt }
+			actual, err := cert.CollectMetrics(ctx, "file://"+tc.Location, tc.Config)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			// every file is an entry with its own leaf
+			var files []string
+			for _, m := range actual {
+				rel, _ := filepath.Rel(dir, m.Tags["file"])
+				files = append(files, rel)
+				host := strings.TrimSuffix(filepath.Base(rel), ".pem") + ".sensu.io"
+				if m.Tags["subject"] != host || len(m.Chain) != 1 || m.Chain[0].Tags["file"] != m.Tags["file"] {
+					t.Errorf("expected %s to hold %s. actual: %v %v", rel, host, m.Tags, m.Chain)
+				}
+			}
+			if !reflect.DeepEqual(files, tc.Expected) {
+				t.Errorf("expected files %v. actual: %v", tc.Expected, files)
+			}
+		})
+	}
+
+	t.Run("key only file is skipped", func(t *testing.T) {
+		keyDir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(keyDir, "a.pem"), certBytes, 0644); err != nil {
+			t.Fatalf("could not write certificate: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(keyDir, "a.key"), testcert.SigningKey, 0600); err != nil {
+			t.Fatalf("could not write private key: %v", err)
+		}
+		actual, err := cert.CollectMetrics(ctx, "file://"+keyDir, cert.Config{Now: func() time.Time { return issuedAt }})
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if len(actual) != 1 || actual[0].Err != nil || actual[0].Tags["file"] != filepath.Join(keyDir, "a.pem") {
+			t.Errorf("expected only the certificate file. actual: %v", actual)
+		}
+	})
+
+	t.Run("corrupt certificate is reported", func(t *testing.T) {
+		corruptDir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(corruptDir, "a.pem"), certBytes, 0644); err != nil {
+			t.Fatalf("could not write certificate: %v", err)
+		}
+		corrupt := []byte(strings.Replace(string(certBytes), "\n", "\n!!", 2))
+		corruptPath := filepath.Join(corruptDir, "b.pem")
+		if err := os.WriteFile(corruptPath, corrupt, 0644); err != nil {
+			t.Fatalf("could not write corrupt certificate: %v", err)
+		}
+		actual, err := cert.CollectMetrics(ctx, "file://"+corruptDir, cert.Config{Now: func() time.Time { return issuedAt }})
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if len(actual) != 2 {
+			t.Fatalf("expected an entry for every file. actual: %d", len(actual))
+		}
+		if actual[0].Err != nil || actual[0].Status() != cert.StatusOK {
+			t.Errorf("expected certificate file to be OK. actual: %s %v", actual[0].Status(), actual[0].Err)
+		}
+		reported := actual[1]
+		if reported.Err == nil || reported.Status() != cert.StatusCritical || reported.Tags["file"] != corruptPath {
+			t.Errorf("expected corrupt file to be critical. actual: %s %v %v", reported.Status(), reported.Tags, reported.Err)
+		}
+		if reason := cert.ErrorReason(reported.Err); reason != cert.ReasonLoad {
+			t.Errorf("expected reason %s. actual: %s", cert.ReasonLoad, reason)
+		}
+	})
+
+	t.Run("files without certificates are skipped", func(t *testing.T) {
+		// a certbot style layout with files that are not certificates
+		liveDir := filepath.Join(t.TempDir(), "live")
+		files := map[string][]byte{
+			"README":            []byte("This directory contains your keys and certificates.\n"),
+			"site/README":       []byte("`cert.pem`  : will break many server configurations\n"),
+			"site/openssl.cnf":  []byte("[ req ]\ndefault_bits = 2048\n"),
+			"site/crontab":      []byte("0 3 * * * certbot renew\n"),
+			"site/compose.yaml": []byte("services:\n  web:\n    image: nginx\n"),
+			"site/privkey.pem":  testcert.SigningKey,
+			"site/cert.pem":     certBytes,
+			// an ASN.1 SEQUENCE named as a certificate that does not parse
+			"site/bad.der": {0x30, 0x03, 0x02, 0x01, 0x01},
+		}
+		for name, data := range files {
+			path := filepath.Join(liveDir, name)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatalf("could not create directory: %v", err)
+			}
+			if err := os.WriteFile(path, data, 0644); err != nil {
+				t.Fatalf("could not write %s: %v", name, err)
+			}
+		}
+		actual, err := cert.CollectMetrics(ctx, "file://"+filepath.Join(liveDir, "*"), cert.Config{Now: func() time.Time { return issuedAt }})
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		status := map[string]cert.Status{}
+		for _, m := range actual {
+			rel, _ := filepath.Rel(liveDir, m.Tags["file"])
+			status[rel] = m.Status()
+		}
+		expected := map[string]cert.Status{
+			"site/bad.der":  cert.StatusCritical,
+			"site/cert.pem": cert.StatusOK,
+		}
+		if !reflect.DeepEqual(status, expected) {
+			t.Errorf("expected %v. actual: %v", expected, status)
+		}
+	})
+
+	if _, err := cert.CollectMetrics(ctx, "file://"+t.TempDir(), cert.Config{}); err == nil {
+		t.Error("expected error for directory without certificates")
+	}
+	if _, err := cert.CollectMetrics(ctx, "file://"+filepath.Join(dir, "*.der"), cert.Config{}); err == nil {
+		t.Error("expected error for pattern without matches")
+	}
+}
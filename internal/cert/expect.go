@@ -0,0 +1,185 @@
+package cert
+
+import (
+	"crypto/x509"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// regexPrefix marks a Pattern as a regular expression instead of a glob.
+const regexPrefix = "re:"
+
+// Pattern matches names with a glob, or with a regular expression when
+// prefixed with re:. Regular expressions match anywhere unless anchored. Globs
+// match the whole name and, unlike file name globs, * also matches / so that
+// URI SANs such as spiffe://cluster/ns/app match spiffe://cluster/*.
+type Pattern struct {
+	raw string
+	re  *regexp.Regexp
+}
+
+// ParsePattern parses a glob or re: prefixed regular expression.
+func ParsePattern(pattern string) (Pattern, error) {
+	p := Pattern{raw: pattern}
+	if strings.HasPrefix(pattern, regexPrefix) {
+		re, err := regexp.Compile(strings.TrimPrefix(pattern, regexPrefix))
+		if err != nil {
+			return p, fmt.Errorf("invalid regular expression %q: %v", pattern, err)
+		}
+		p.re = re
+		return p, nil
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return p, fmt.Errorf("invalid glob pattern %q", pattern)
+	}
+	p.re = regexp.MustCompile(globRegexp(pattern))
+	return p, nil
+}
+
+// globRegexp translates a glob with the syntax of path.Match into an anchored
+// regular expression in which * matches any sequence of characters.
+func globRegexp(glob string) string {
+	var b strings.Builder
+	b.WriteString("(?s)^")
+	runes := []rune(glob)
+	inClass := false
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\' && i+1 < len(runes):
+			i++
+			fmt.Fprintf(&b, `\x{%x}`, runes[i])
+		case inClass && r == ']':
+			inClass = false
+			b.WriteRune(r)
+		case inClass && (r == '-' || (r == '^' && runes[i-1] == '[')):
+			b.WriteRune(r)
+		case inClass:
+			fmt.Fprintf(&b, `\x{%x}`, r)
+		case r == '[':
+			inClass = true
+			b.WriteRune(r)
+		case r == '*':
+			b.WriteString(".*")
+		case r == '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// Match reports whether the name matches the pattern.
+func (p Pattern) Match(name string) bool {
+	return p.re.MatchString(name)
+}
+
+func (p Pattern) String() string {
+	return p.raw
+}
+
+// Expectations asserted against the leaf certificate.
+type Expectations struct {
+	// Issuer must match one of these patterns, by common name or
+	// distinguished name
+	Issuer []Pattern
+	// Subject must match one of these patterns, by common name or
+	// distinguished name
+	Subject []Pattern
+	// SAN patterns must each match a subject alternative name
+	SAN []Pattern
+	// Org must match one of the subject organizations
+	Org []Pattern
+}
+
+// Expectation is the result of asserting one kind of expectation.
+type Expectation struct {
+	// Name of the expectation: issuer, subject, san or org
+	Name string
+	Met  bool
+}
+
+// evaluateExpectations asserts the configured expectations against the leaf,
+// with a critical finding for each that is not met.
+func evaluateExpectations(leaf *x509.Certificate, expect Expectations) ([]Expectation, []Finding) {
+	var results []Expectation
+	var findings []Finding
+	subject := name(leaf.Subject)
+	fail := func(format string, args ...interface{}) {
+		findings = append(findings, Finding{Status: StatusCritical, Message: fmt.Sprintf(format, args...)})
+	}
+	if len(expect.Issuer) > 0 {
+		met := matchAny(expect.Issuer, leaf.Issuer.CommonName, leaf.Issuer.String())
+		if !met {
+			fail("issuer %q of %s does not match %s", leaf.Issuer.String(), subject, patternList(expect.Issuer))
+		}
+		results = append(results, Expectation{Name: "issuer", Met: met})
+	}
+	if len(expect.Subject) > 0 {
+		met := matchAny(expect.Subject, leaf.Subject.CommonName, leaf.Subject.String())
+		if !met {
+			fail("subject %q does not match %s", leaf.Subject.String(), patternList(expect.Subject))
+		}
+		results = append(results, Expectation{Name: "subject", Met: met})
+	}
+	if len(expect.SAN) > 0 {
+		sans := subjectAltNames(leaf)
+		met := true
+		for _, p := range expect.SAN {
+			if !matchAny([]Pattern{p}, sans...) {
+				met = false
+				fail("%s has no subject alternative name matching %q, has %s", subject, p.String(), strings.Join(sans, ", "))
+			}
+		}
+		results = append(results, Expectation{Name: "san", Met: met})
+	}
+	if len(expect.Org) > 0 {
+		met := matchAny(expect.Org, leaf.Subject.Organization...)
+		if !met {
+			fail("organization %q of %s does not match %s", strings.Join(leaf.Subject.Organization, ", "), subject, patternList(expect.Org))
+		}
+		results = append(results, Expectation{Name: "org", Met: met})
+	}
+	return results, findings
+}
+
+// matchAny reports whether any of the names match any of the patterns.
+func matchAny(patterns []Pattern, names ...string) bool {
+	for _, p := range patterns {
+		for _, n := range names {
+			if n != "" && p.Match(n) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func patternList(patterns []Pattern) string {
+	quoted := make([]string, 0, len(patterns))
+	for _, p := range patterns {
+		quoted = append(quoted, fmt.Sprintf("%q", p.String()))
+	}
+	if len(quoted) == 1 {
+		return quoted[0]
+	}
+	return "any of " + strings.Join(quoted, ", ")
+}
+
+// subjectAltNames lists the DNS names, IP addresses, email addresses and
+// URIs of the certificate.
+func subjectAltNames(c *x509.Certificate) []string {
+	sans := append([]string{}, c.DNSNames...)
+	for _, ip := range c.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, c.EmailAddresses...)
+	for _, u := range c.URIs {
+		sans = append(sans, u.String())
+	}
+	return sans
+}
@@ -0,0 +1,185 @@
+package cert_test
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sensu/cert-checks/internal/cert"
+	"github.com/sensu/cert-checks/internal/cert/testcert"
+)
+
+func TestParsePattern(t *testing.T) {
+	testCases := []struct {
+		Pattern   string
+		Name      string
+		Expected  bool
+		ExpectErr bool
+	}{
+		{Pattern: "*.sensu.io", Name: "api.sensu.io", Expected: true},
+		{Pattern: "*.sensu.io", Name: "sensu.io", Expected: false},
+		{Pattern: "api.sensu.io", Name: "api.sensu.io", Expected: true},
+		{Pattern: "spiffe://cluster.local/*", Name: "spiffe://cluster.local/ns/web/sa/api", Expected: true},
+		{Pattern: "spiffe://cluster.local/ns/?eb/*", Name: "spiffe://cluster.local/ns/web/sa/api", Expected: true},
+		{Pattern: "[a-c]pi.sensu.io", Name: "api.sensu.io", Expected: true},
+		{Pattern: "[^a-c]pi.sensu.io", Name: "api.sensu.io", Expected: false},
+		{Pattern: "\\*.sensu.io", Name: "*.sensu.io", Expected: true},
+		{Pattern: "\\*.sensu.io", Name: "api.sensu.io", Expected: false},
+		{Pattern: "api.sensu.io", Name: "apixsensu.io", Expected: false},
+		{Pattern: "re:^(api|www)\\.sensu\\.io$", Name: "www.sensu.io", Expected: true},
+		{Pattern: "re:^(api|www)\\.sensu\\.io$", Name: "dev.sensu.io", Expected: false},
+		{Pattern: "re:Staging", Name: "CN=Staging CA,O=Sensu", Expected: true},
+		{Pattern: "re:(", ExpectErr: true},
+		{Pattern: "[", ExpectErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Pattern, func(t *testing.T) {
+			p, err := cert.ParsePattern(tc.Pattern)
+			if err != nil && !tc.ExpectErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if err == nil && tc.ExpectErr {
+				t.Fatalf("expected error parsing %q", tc.Pattern)
+			}
+			if err == nil && p.Match(tc.Name) != tc.Expected {
+				t.Errorf("expected %q matching %q to be %v", tc.Pattern, tc.Name, tc.Expected)
+			}
+		})
+	}
+}
+
+func TestCollectMetricsExpectations(t *testing.T) {
+	ctx := context.Background()
+
+	issuedAt := time.Now().Add(-time.Hour)
+	duration := time.Hour * 72
+	ca, _, err := testcert.New("Staging CA", issuedAt, duration)
+	if err != nil {
+		t.Fatalf("could not create CA certificate: %v", err)
+	}
+	_, chainBytes, err := testcert.NewIssued("api.sensu.io", issuedAt, duration, ca, func(c *x509.Certificate) {
+		c.DNSNames = []string{"api.sensu.io", "www.sensu.io"}
+		c.IPAddresses = []net.IP{net.ParseIP("10.0.0.1")}
+		uri, _ := url.Parse("spiffe://cluster.local/ns/web/sa/api")
+		c.URIs = []*url.URL{uri}
+	})
+	if err != nil {
+		t.Fatalf("could not create leaf certificate: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "chain.pem")
+	if err := os.WriteFile(path, chainBytes, 0644); err != nil {
+		t.Fatalf("could not write certificate chain: %v", err)
+	}
+	patterns := func(values ...string) []cert.Pattern {
+		var ps []cert.Pattern
+		for _, v := range values {
+			p, err := cert.ParsePattern(v)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			ps = append(ps, p)
+		}
+		return ps
+	}
+
+	testCases := []struct {
+		Name           string
+		Expect         cert.Expectations
+		Expected       []cert.Expectation
+		ExpectedStatus cert.Status
+		ExpectedMsgs   []string
+	}{
+		{
+			Name:           "no expectations",
+			ExpectedStatus: cert.StatusOK,
+		}, {
+			Name: "all met",
+			Expect: cert.Expectations{
+				Issuer:  patterns("Production CA", "Staging CA"),
+				Subject: patterns("re:^CN=api\\.sensu\\.io,"),
+				SAN:     patterns("*.sensu.io", "10.0.0.*", "spiffe://cluster.local/*"),
+				Org:     patterns("Sumo Logic*"),
+			},
+			Expected: []cert.Expectation{
+				{Name: "issuer", Met: true},
+				{Name: "subject", Met: true},
+				{Name: "san", Met: true},
+				{Name: "org", Met: true},
+			},
+			ExpectedStatus: cert.StatusOK,
+		}, {
+			Name:           "staging issuer",
+			Expect:         cert.Expectations{Issuer: patterns("Production CA")},
+			Expected:       []cert.Expectation{{Name: "issuer", Met: false}},
+			ExpectedStatus: cert.StatusCritical,
+			ExpectedMsgs:   []string{`issuer "CN=Staging CA,OU=Sensu Test,O=Sumo Logic Inc" of api.sensu.io does not match "Production CA"`},
+		}, {
+			Name:           "distinguished name issuer",
+			Expect:         cert.Expectations{Issuer: patterns("re:O=Sumo Logic Inc$")},
+			Expected:       []cert.Expectation{{Name: "issuer", Met: true}},
+			ExpectedStatus: cert.StatusOK,
+		}, {
+			Name:           "subject",
+			Expect:         cert.Expectations{Subject: patterns("www.sensu.io", "dev.sensu.io")},
+			Expected:       []cert.Expectation{{Name: "subject", Met: false}},
+			ExpectedStatus: cert.StatusCritical,
+			ExpectedMsgs:   []string{`subject "CN=api.sensu.io,OU=Sensu Test,O=Sumo Logic Inc" does not match any of "www.sensu.io", "dev.sensu.io"`},
+		}, {
+			Name:           "every SAN must match",
+			Expect:         cert.Expectations{SAN: patterns("www.sensu.io", "dev.sensu.io")},
+			Expected:       []cert.Expectation{{Name: "san", Met: false}},
+			ExpectedStatus: cert.StatusCritical,
+			ExpectedMsgs:   []string{`api.sensu.io has no subject alternative name matching "dev.sensu.io", has api.sensu.io, www.sensu.io, 10.0.0.1, spiffe://cluster.local/ns/web/sa/api`},
+		}, {
+			Name:           "URI SAN",
+			Expect:         cert.Expectations{SAN: patterns("spiffe://cluster.local/ns/web/*")},
+			Expected:       []cert.Expectation{{Name: "san", Met: true}},
+			ExpectedStatus: cert.StatusOK,
+		}, {
+			Name:           "URI SAN in another namespace",
+			Expect:         cert.Expectations{SAN: patterns("spiffe://cluster.local/ns/db/*")},
+			Expected:       []cert.Expectation{{Name: "san", Met: false}},
+			ExpectedStatus: cert.StatusCritical,
+			ExpectedMsgs:   []string{`api.sensu.io has no subject alternative name matching "spiffe://cluster.local/ns/db/*", has api.sensu.io, www.sensu.io, 10.0.0.1, spiffe://cluster.local/ns/web/sa/api`},
+		}, {
+			Name:           "organization",
+			Expect:         cert.Expectations{Org: patterns("Sensu Inc")},
+			Expected:       []cert.Expectation{{Name: "org", Met: false}},
+			ExpectedStatus: cert.StatusCritical,
+			ExpectedMsgs:   []string{`organization "Sumo Logic Inc" of api.sensu.io does not match "Sensu Inc"`},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			actual, err := collectSingle(t, ctx, "file://"+path, cert.Config{Expect: tc.Expect})
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(actual.Expectations, tc.Expected) {
+				t.Errorf("expected %v. actual: %v", tc.Expected, actual.Expectations)
+			}
+			if status := actual.Status(); status != tc.ExpectedStatus {
+				t.Errorf("expected status %v. actual: %v (%v)", tc.ExpectedStatus, status, actual.Findings)
+			}
+			var msgs []string
+			for _, f := range actual.Findings {
+				msgs = append(msgs, f.Message)
+			}
+			if !reflect.DeepEqual(msgs, tc.ExpectedMsgs) {
+				t.Errorf("expected findings %q. actual: %q", tc.ExpectedMsgs, msgs)
+			}
+			for _, e := range tc.Expected {
+				if !strings.Contains(cert.Output(actual), `expectation="`+e.Name+`"`) {
+					t.Errorf("expected %s expectation in output", e.Name)
+				}
+			}
+		})
+	}
+}
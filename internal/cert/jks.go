@@ -0,0 +1,430 @@
+package cert
+
+import (
+	"crypto/sha1"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+)
+
+const (
+	jksMagic   = 0xfeedfeed
+	jceksMagic = 0xcececece
+
+	jksPrivateKeyEntry    = 1
+	jksTrustedCertEntry   = 2
+	jceksSecretKeyEntry   = 3
+	jksIntegrityWhitening = "Mighty Aphrodite"
+)
+
+var errJKSTruncated = errors.New("unexpected end of keystore")
+
+// isJKS reports whether data starts with the JKS or JCEKS magic number.
+func isJKS(data []byte) bool {
+	if len(data) < 4 {
+		return false
+	}
+	magic := binary.BigEndian.Uint32(data)
+	return magic == jksMagic || magic == jceksMagic
+}
+
+// decodeJKS returns the chain of every entry in a JKS or JCEKS keystore,
+// tagged with the entry alias. JCEKS secret key entries are skipped. The
+// keystore integrity is checked when a password is given. Private keys are
+// never decrypted.
+func decodeJKS(data []byte, password string) (*loadResult, error) {
+	if !isJKS(data) || len(data) < 12+sha1.Size {
+		return nil, fmt.Errorf("error decoding Java keystore: not a JKS or JCEKS keystore")
+	}
+	body, digest := data[:len(data)-sha1.Size], data[len(data)-sha1.Size:]
+	if password != "" && !jksIntegrity(body, digest, password) {
+		return nil, fmt.Errorf("error decoding Java keystore: incorrect password or keystore corrupted")
+	}
+
+	r := &jksReader{data: body[4:]}
+	version := r.uint32()
+	if version != 1 && version != 2 {
+		return nil, fmt.Errorf("error decoding Java keystore: unsupported version %d", version)
+	}
+	count := r.uint32()
+	result := &loadResult{}
+	for i := uint32(0); i < count && r.err == nil; i++ {
+		tag := r.uint32()
+		alias := r.utf()
+		// creation date
+		r.next(8)
+		switch tag {
+		case jksPrivateKeyEntry:
+			r.next(int(r.uint32()))
+			chainLen := r.uint32()
+			var chain []*x509.Certificate
+			for j := uint32(0); j < chainLen && r.err == nil; j++ {
+				c, err := readJKSCertificate(r, version, alias)
+				if err != nil {
+					return nil, err
+				}
+				chain = append(chain, c)
+			}
+			if len(chain) > 0 {
+				result.entries = append(result.entries, entry{chain: chain, tags: map[string]string{"alias": alias}})
+			}
+		case jksTrustedCertEntry:
+			c, err := readJKSCertificate(r, version, alias)
+			if err != nil {
+				return nil, err
+			}
+			result.entries = append(result.entries, entry{chain: []*x509.Certificate{c}, tags: map[string]string{"alias": alias}})
+		case jceksSecretKeyEntry:
+			// secret keys hold no certificates, skip their sealed object
+			if err := skipJavaObject(r); err != nil {
+				return nil, fmt.Errorf("error decoding Java keystore: secret key entry %q: %v", alias, err)
+			}
+		default:
+			return nil, fmt.Errorf("error decoding Java keystore: unknown entry type %d", tag)
+		}
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("error decoding Java keystore: %v", r.err)
+	}
+	if len(result.entries) == 0 {
+		return nil, fmt.Errorf("error decoding Java keystore: no certificates found")
+	}
+	return result, nil
+}
+
+// readJKSCertificate reads a certificate of the entry alias.
+func readJKSCertificate(r *jksReader, version uint32, alias string) (*x509.Certificate, error) {
+	if version == 2 {
+		if certType := r.utf(); r.err == nil && certType != "X.509" {
+			return nil, fmt.Errorf("error decoding Java keystore: unsupported certificate type %q for %q", certType, alias)
+		}
+	}
+	der := r.next(int(r.uint32()))
+	if r.err != nil {
+		return nil, fmt.Errorf("error decoding Java keystore: %v", r.err)
+	}
+	c, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing x509 certificate for %q %v", alias, err)
+	}
+	return c, nil
+}
+
+// jksIntegrity checks the keystore digest, a SHA-1 of the UTF-16 password,
+// a fixed whitening string and the keystore contents.
+func jksIntegrity(body, digest []byte, password string) bool {
+	h := sha1.New()
+	for _, c := range utf16.Encode([]rune(password)) {
+		h.Write([]byte{byte(c >> 8), byte(c)})
+	}
+	h.Write([]byte(jksIntegrityWhitening))
+	h.Write(body)
+	return subtle.ConstantTimeCompare(h.Sum(nil), digest) == 1
+}
+
+// jksReader reads big endian keystore fields, remembering the first error.
+type jksReader struct {
+	data []byte
+	err  error
+}
+
+func (r *jksReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.data) {
+		r.err = errJKSTruncated
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *jksReader) uint32() uint32 {
+	b := r.next(4)
+	if len(b) < 4 {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (r *jksReader) uint16() uint16 {
+	b := r.next(2)
+	if len(b) < 2 {
+		return 0
+	}
+	return binary.BigEndian.Uint16(b)
+}
+
+func (r *jksReader) uint64() uint64 {
+	b := r.next(8)
+	if len(b) < 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+// utf reads a length prefixed modified UTF-8 string.
+func (r *jksReader) utf() string {
+	b := r.next(2)
+	if len(b) < 2 {
+		return ""
+	}
+	return string(r.next(int(binary.BigEndian.Uint16(b))))
+}
+
+// Java object serialization constants, used to skip the sealed objects of
+// JCEKS secret key entries.
+const (
+	javaStreamHeader = 0xaced0005
+	javaBaseHandle   = 0x7e0000
+	// javaMaxDepth bounds the nesting of skipped objects
+	javaMaxDepth = 64
+
+	tcNull           = 0x70
+	tcReference      = 0x71
+	tcClassDesc      = 0x72
+	tcObject         = 0x73
+	tcString         = 0x74
+	tcArray          = 0x75
+	tcClass          = 0x76
+	tcBlockData      = 0x77
+	tcEndBlockData   = 0x78
+	tcReset          = 0x79
+	tcBlockDataLong  = 0x7a
+	tcLongString     = 0x7c
+	tcProxyClassDesc = 0x7d
+	tcEnum           = 0x7e
+
+	scWriteMethod    = 0x01
+	scSerializable   = 0x02
+	scExternalizable = 0x04
+	scBlockData      = 0x08
+)
+
+// javaPrimitiveSizes of the field type codes of primitive types.
+var javaPrimitiveSizes = map[byte]int{
+	'B': 1, 'C': 2, 'D': 8, 'F': 4, 'I': 4, 'J': 8, 'S': 2, 'Z': 1,
+}
+
+// javaClassDesc is the part of a serialized class description needed to
+// skip the data of its instances.
+type javaClassDesc struct {
+	name  string
+	flags byte
+	// fields holds the type code of every serialized field
+	fields []byte
+	super  *javaClassDesc
+}
+
+// javaStream skips the contents of a Java object serialization stream.
+type javaStream struct {
+	r *jksReader
+	// handles to class descriptions, nil for other objects
+	handles []*javaClassDesc
+	depth   int
+}
+
+// skipJavaObject skips a serialization stream holding a single object.
+func skipJavaObject(r *jksReader) error {
+	if r.uint32() != javaStreamHeader && r.err == nil {
+		return fmt.Errorf("not a Java serialization stream")
+	}
+	s := &javaStream{r: r}
+	_, err := s.content()
+	return err
+}
+
+func (s *javaStream) byte() byte {
+	b := s.r.next(1)
+	if len(b) < 1 {
+		return 0
+	}
+	return b[0]
+}
+
+// content skips the next element of the stream, returning it when it is a
+// class description.
+func (s *javaStream) content() (*javaClassDesc, error) {
+	if s.depth++; s.depth > javaMaxDepth {
+		return nil, fmt.Errorf("serialized object nested too deeply")
+	}
+	defer func() { s.depth-- }()
+	tc := s.byte()
+	if s.r.err != nil {
+		return nil, s.r.err
+	}
+	switch tc {
+	case tcNull:
+		return nil, nil
+	case tcReference:
+		h := int(s.r.uint32()) - javaBaseHandle
+		if s.r.err != nil {
+			return nil, s.r.err
+		}
+		if h < 0 || h >= len(s.handles) {
+			return nil, fmt.Errorf("invalid serialization handle")
+		}
+		return s.handles[h], nil
+	case tcClassDesc:
+		desc := &javaClassDesc{name: s.r.utf()}
+		// serialVersionUID
+		s.r.next(8)
+		s.handles = append(s.handles, desc)
+		desc.flags = s.byte()
+		n := int(s.r.uint16())
+		for i := 0; i < n && s.r.err == nil; i++ {
+			t := s.byte()
+			s.r.utf()
+			if t == 'L' || t == '[' {
+				// class name of the field
+				if _, err := s.content(); err != nil {
+					return nil, err
+				}
+			}
+			desc.fields = append(desc.fields, t)
+		}
+		if err := s.annotation(); err != nil {
+			return nil, err
+		}
+		var err error
+		desc.super, err = s.content()
+		return desc, err
+	case tcProxyClassDesc:
+		desc := &javaClassDesc{flags: scSerializable}
+		s.handles = append(s.handles, desc)
+		n := int(s.r.uint32())
+		for i := 0; i < n && s.r.err == nil; i++ {
+			s.r.utf()
+		}
+		if err := s.annotation(); err != nil {
+			return nil, err
+		}
+		var err error
+		desc.super, err = s.content()
+		return desc, err
+	case tcObject:
+		desc, err := s.content()
+		if err != nil {
+			return nil, err
+		}
+		if desc == nil {
+			return nil, fmt.Errorf("serialized object without class")
+		}
+		s.handles = append(s.handles, nil)
+		return nil, s.classData(desc)
+	case tcClass, tcEnum:
+		if _, err := s.content(); err != nil {
+			return nil, err
+		}
+		s.handles = append(s.handles, nil)
+		if tc == tcEnum {
+			// constant name
+			if _, err := s.content(); err != nil {
+				return nil, err
+			}
+		}
+	case tcArray:
+		desc, err := s.content()
+		if err != nil {
+			return nil, err
+		}
+		if desc == nil || len(desc.name) < 2 {
+			return nil, fmt.Errorf("serialized array without class")
+		}
+		s.handles = append(s.handles, nil)
+		n := int(s.r.uint32())
+		if n < 0 || n > len(s.r.data) {
+			return nil, errJKSTruncated
+		}
+		if size, ok := javaPrimitiveSizes[desc.name[1]]; ok {
+			s.r.next(n * size)
+			break
+		}
+		for i := 0; i < n && s.r.err == nil; i++ {
+			if _, err := s.content(); err != nil {
+				return nil, err
+			}
+		}
+	case tcString:
+		s.handles = append(s.handles, nil)
+		s.r.utf()
+	case tcLongString:
+		s.handles = append(s.handles, nil)
+		n := s.r.uint64()
+		if n > uint64(len(s.r.data)) {
+			return nil, errJKSTruncated
+		}
+		s.r.next(int(n))
+	case tcBlockData:
+		s.r.next(int(s.byte()))
+	case tcBlockDataLong:
+		s.r.next(int(s.r.uint32()))
+	case tcReset:
+		s.handles = nil
+	default:
+		return nil, fmt.Errorf("unsupported serialization type 0x%02x", tc)
+	}
+	return nil, s.r.err
+}
+
+// annotation skips the contents written by annotateClass or writeObject, up
+// to the end block marker.
+func (s *javaStream) annotation() error {
+	for {
+		if s.r.err != nil {
+			return s.r.err
+		}
+		if len(s.r.data) > 0 && s.r.data[0] == tcEndBlockData {
+			s.r.next(1)
+			return nil
+		}
+		if _, err := s.content(); err != nil {
+			return err
+		}
+	}
+}
+
+// classData skips the field values of an object, from its topmost
+// serializable superclass down to its own class.
+func (s *javaStream) classData(desc *javaClassDesc) error {
+	var classes []*javaClassDesc
+	seen := map[*javaClassDesc]bool{}
+	for d := desc; d != nil; d = d.super {
+		// a corrupt stream may reference a class as its own superclass
+		if seen[d] {
+			return fmt.Errorf("serialized class %s is its own superclass", d.name)
+		}
+		seen[d] = true
+		classes = append([]*javaClassDesc{d}, classes...)
+	}
+	for _, d := range classes {
+		switch {
+		case d.flags&scExternalizable != 0:
+			if d.flags&scBlockData == 0 {
+				return fmt.Errorf("unsupported externalizable class %s", d.name)
+			}
+			if err := s.annotation(); err != nil {
+				return err
+			}
+		case d.flags&scSerializable != 0:
+			for _, t := range d.fields {
+				if size, ok := javaPrimitiveSizes[t]; ok {
+					s.r.next(size)
+				} else if _, err := s.content(); err != nil {
+					return err
+				}
+			}
+			if d.flags&scWriteMethod != 0 {
+				if err := s.annotation(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return s.r.err
+}
@@ -0,0 +1,305 @@
+package cert_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"github.com/sensu/cert-checks/internal/cert"
+	"github.com/sensu/cert-checks/internal/cert/testcert"
+)
+
+type jksEntry struct {
+	alias   string
+	trusted bool
+	chain   [][]byte
+	// sealed is the serialized key of JCEKS secret key entries
+	sealed []byte
+}
+
+// encodeJKS writes a version 2 JKS keystore. Private keys are stored as
+// opaque bytes since they are never decrypted.
+func encodeJKS(magic uint32, entries []jksEntry, password string) []byte {
+	var buf bytes.Buffer
+	writeUTF := func(s string) {
+		_ = binary.Write(&buf, binary.BigEndian, uint16(len(s)))
+		buf.WriteString(s)
+	}
+	writeCert := func(der []byte) {
+		writeUTF("X.509")
+		_ = binary.Write(&buf, binary.BigEndian, uint32(len(der)))
+		buf.Write(der)
+	}
+	_ = binary.Write(&buf, binary.BigEndian, []uint32{magic, 2, uint32(len(entries))})
+	for _, e := range entries {
+		if e.sealed != nil {
+			_ = binary.Write(&buf, binary.BigEndian, uint32(3))
+			writeUTF(e.alias)
+			_ = binary.Write(&buf, binary.BigEndian, uint64(1<<40))
+			buf.Write(e.sealed)
+			continue
+		}
+		if e.trusted {
+			_ = binary.Write(&buf, binary.BigEndian, uint32(2))
+		} else {
+			_ = binary.Write(&buf, binary.BigEndian, uint32(1))
+		}
+		writeUTF(e.alias)
+		_ = binary.Write(&buf, binary.BigEndian, uint64(1<<40))
+		if e.trusted {
+			writeCert(e.chain[0])
+			continue
+		}
+		key := []byte("encrypted private key")
+		_ = binary.Write(&buf, binary.BigEndian, uint32(len(key)))
+		buf.Write(key)
+		_ = binary.Write(&buf, binary.BigEndian, uint32(len(e.chain)))
+		for _, der := range e.chain {
+			writeCert(der)
+		}
+	}
+	h := sha1.New()
+	for _, c := range utf16.Encode([]rune(password)) {
+		h.Write([]byte{byte(c >> 8), byte(c)})
+	}
+	h.Write([]byte("Mighty Aphrodite"))
+	h.Write(buf.Bytes())
+	buf.Write(h.Sum(nil))
+	return buf.Bytes()
+}
+
+// sealedKey serializes a SealedObjectForKeyProtector, the way JCEKS stores
+// secret keys.
+func sealedKey() []byte {
+	var buf bytes.Buffer
+	write := func(values ...interface{}) {
+		for _, v := range values {
+			_ = binary.Write(&buf, binary.BigEndian, v)
+		}
+	}
+	writeUTF := func(s string) {
+		write(uint16(len(s)))
+		buf.WriteString(s)
+	}
+	write(uint32(0xaced0005))
+	// object of a class without fields, handle 0x7e0000
+	write(byte(0x73), byte(0x72))
+	writeUTF("com.sun.crypto.provider.SealedObjectForKeyProtector")
+	write(int64(-3650226485480866989), byte(0x02), uint16(0), byte(0x78))
+	// its superclass, handle 0x7e0001, with field class names 0x7e0002 and 0x7e0003
+	write(byte(0x72))
+	writeUTF("javax.crypto.SealedObject")
+	write(int64(4482838265551344752), byte(0x02), uint16(4))
+	write(byte('['))
+	writeUTF("encodedParams")
+	write(byte(0x74))
+	writeUTF("[B")
+	write(byte('['))
+	writeUTF("encryptedContent")
+	write(byte(0x71), uint32(0x7e0002))
+	write(byte('L'))
+	writeUTF("paramsAlg")
+	write(byte(0x74))
+	writeUTF("Ljava/lang/String;")
+	write(byte('L'))
+	writeUTF("sealAlg")
+	write(byte(0x71), uint32(0x7e0003))
+	write(byte(0x78), byte(0x70))
+	// the object is handle 0x7e0004, its byte array class 0x7e0005
+	write(byte(0x75), byte(0x72))
+	writeUTF("[B")
+	write(int64(-5984413125824719648), byte(0x02), uint16(0), byte(0x78), byte(0x70), uint32(4), []byte{1, 2, 3, 4})
+	write(byte(0x75), byte(0x71), uint32(0x7e0005), uint32(2), []byte{5, 6})
+	write(byte(0x74))
+	writeUTF("PBEWithMD5AndTripleDES")
+	write(byte(0x71), uint32(0x7e0008))
+	return buf.Bytes()
+}
+
+// cyclicSealedKey serializes an object whose class, handle 0x7e0000,
+// references itself as its superclass.
+func cyclicSealedKey() []byte {
+	var buf bytes.Buffer
+	write := func(values ...interface{}) {
+		for _, v := range values {
+			_ = binary.Write(&buf, binary.BigEndian, v)
+		}
+	}
+	write(uint32(0xaced0005), byte(0x73), byte(0x72), uint16(1), byte('A'))
+	write(int64(1), byte(0x02), uint16(0), byte(0x78), byte(0x71), uint32(0x7e0000))
+	return buf.Bytes()
+}
+
+func TestCollectMetricsFromJKS(t *testing.T) {
+	ctx := context.Background()
+
+	issuedAt := time.Unix(1<<30, 0)
+	duration := time.Hour * 72
+	root, _, err := testcert.New("root.sensu.io", issuedAt, duration)
+	if err != nil {
+		t.Fatalf("could not create root certificate: %v", err)
+	}
+	leaf, _, err := testcert.NewIssued("kafka.sensu.io", issuedAt, duration, root)
+	if err != nil {
+		t.Fatalf("could not create leaf certificate: %v", err)
+	}
+
+	const password = "changeit"
+	keystore := encodeJKS(0xfeedfeed, []jksEntry{
+		{alias: "kafka", chain: leaf.Certificate},
+		{alias: "ca", trusted: true, chain: root.Certificate},
+	}, password)
+	jceks := encodeJKS(0xcececece, []jksEntry{
+		{alias: "kafka", chain: leaf.Certificate},
+		{alias: "secret", sealed: sealedKey()},
+		{alias: "ca", trusted: true, chain: root.Certificate},
+	}, password)
+	truncatedSecret := encodeJKS(0xcececece, []jksEntry{
+		{alias: "secret", sealed: sealedKey()[:40]},
+	}, password)
+	cyclicSecret := encodeJKS(0xcececece, []jksEntry{
+		{alias: "secret", sealed: cyclicSealedKey()},
+	}, password)
+	var trusted []jksEntry
+	for i := 0; i < 200; i++ {
+		ca, _, err := testcert.New(fmt.Sprintf("ca%d.sensu.io", i), issuedAt, duration)
+		if err != nil {
+			t.Fatalf("could not create CA certificate: %v", err)
+		}
+		trusted = append(trusted, jksEntry{alias: fmt.Sprintf("ca%d", i), trusted: true, chain: ca.Certificate})
+	}
+	truststore := encodeJKS(0xfeedfeed, trusted, password)
+
+	tmpDir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatalf("could not write %s: %v", name, err)
+		}
+		return path
+	}
+	keystorePath := write("keystore.jks", keystore)
+	jceksPath := write("keystore.jceks", jceks)
+	truststorePath := write("truststore.jks", truststore)
+	truncatedPath := write("truncated.jks", keystore[:len(keystore)/2])
+	truncatedSecretPath := write("truncated.jceks", truncatedSecret)
+	cyclicSecretPath := write("cyclic.jceks", cyclicSecret)
+
+	type expectedCert struct {
+		alias   string
+		subject string
+	}
+	testCases := []struct {
+		Name      string
+		Cert      string
+		Password  string
+		Expected  []expectedCert
+		ExpectErr bool
+	}{
+		{
+			Name:     "jks scheme",
+			Cert:     "jks://" + keystorePath,
+			Password: password,
+			Expected: []expectedCert{{"kafka", "kafka.sensu.io"}, {"kafka", "root.sensu.io"}, {"ca", "root.sensu.io"}},
+		}, {
+			Name:     "detected from file",
+			Cert:     "file://" + keystorePath,
+			Password: password,
+			Expected: []expectedCert{{"kafka", "kafka.sensu.io"}, {"kafka", "root.sensu.io"}, {"ca", "root.sensu.io"}},
+		}, {
+			Name:     "without password",
+			Cert:     "jks://" + keystorePath,
+			Expected: []expectedCert{{"kafka", "kafka.sensu.io"}, {"kafka", "root.sensu.io"}, {"ca", "root.sensu.io"}},
+		}, {
+			Name:     "jceks",
+			Cert:     "jks://" + jceksPath,
+			Password: password,
+			Expected: []expectedCert{{"kafka", "kafka.sensu.io"}, {"kafka", "root.sensu.io"}, {"ca", "root.sensu.io"}},
+		}, {
+			Name:      "incorrect password",
+			Cert:      "jks://" + keystorePath,
+			Password:  "wrong",
+			ExpectErr: true,
+		}, {
+			Name:      "truncated keystore",
+			Cert:      "jks://" + truncatedPath,
+			ExpectErr: true,
+		}, {
+			Name:      "truncated secret key",
+			Cert:      "jks://" + truncatedSecretPath,
+			Password:  password,
+			ExpectErr: true,
+		}, {
+			Name:      "secret key class is its own superclass",
+			Cert:      "jks://" + cyclicSecretPath,
+			Password:  password,
+			ExpectErr: true,
+		}, {
+			Name:      "not a keystore",
+			Cert:      "jks://" + write("cert.der", leaf.Certificate[0]),
+			ExpectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			results, err := cert.CollectMetrics(ctx, tc.Cert, cert.Config{
+				Now:      func() time.Time { return issuedAt },
+				Password: tc.Password,
+			})
+			if err != nil && !tc.ExpectErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if err != nil {
+				return
+			}
+			if tc.ExpectErr {
+				t.Fatal("expected error")
+			}
+			// each alias is an entry whose leaf tags the whole entry
+			var chain []cert.CertificateMetrics
+			for _, m := range results {
+				if m.Tags["alias"] != m.Chain[0].Tags["alias"] || m.Tags["subject"] != m.Chain[0].Tags["subject"] {
+					t.Errorf("expected entry tags to match its leaf. actual: %v %v", m.Tags, m.Chain[0].Tags)
+				}
+				chain = append(chain, m.Chain...)
+			}
+			if len(chain) != len(tc.Expected) {
+				t.Fatalf("expected %d certificates. actual: %d", len(tc.Expected), len(chain))
+			}
+			for i, e := range tc.Expected {
+				tags := chain[i].Tags
+				if tags["alias"] != e.alias || tags["subject"] != e.subject {
+					t.Errorf("expected certificate %d alias %s subject %s. actual: %v", i, e.alias, e.subject, tags)
+				}
+			}
+		})
+	}
+
+	t.Run("large trust store", func(t *testing.T) {
+		results, err := cert.CollectMetrics(ctx, "jks://"+truststorePath, cert.Config{
+			Now:      func() time.Time { return issuedAt },
+			Password: password,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if len(results) != len(trusted) {
+			t.Fatalf("expected %d entries. actual: %d", len(trusted), len(results))
+		}
+		aliases := map[string]bool{}
+		for _, m := range results {
+			aliases[m.Tags["alias"]] = true
+		}
+		if len(aliases) != len(trusted) {
+			t.Errorf("expected %d distinct aliases. actual: %d", len(trusted), len(aliases))
+		}
+	})
+}
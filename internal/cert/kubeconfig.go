@@ -0,0 +1,134 @@
+package cert
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+)
+
+// kubeconfig is the subset of a kubectl config file holding certificates.
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			ClientCertificate     string `yaml:"client-certificate"`
+			ClientCertificateData string `yaml:"client-certificate-data"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster string `yaml:"cluster"`
+			User    string `yaml:"user"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+}
+
+// kubeconfigCertificate is a certificate embedded in, or referenced by, a
+// cluster or user.
+type kubeconfigCertificate struct {
+	data string
+	file string
+}
+
+// decodeKubeconfig finds the client certificates of users and the certificate
+// authorities of clusters in a kubeconfig file at path. Each is an entry, or
+// one for every chain of a CA bundle, tagged with the context, cluster and
+// user it belongs to, the current context first. Clusters and users without
+// a context are reported on their own. Referenced files are relative to the
+// kubeconfig file.
+func decodeKubeconfig(path string, data []byte) (*loadResult, error) {
+	var config kubeconfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("error decoding kubeconfig: %v", err)
+	}
+	cas := map[string]kubeconfigCertificate{}
+	for _, c := range config.Clusters {
+		cas[c.Name] = kubeconfigCertificate{data: c.Cluster.CertificateAuthorityData, file: c.Cluster.CertificateAuthority}
+	}
+	clients := map[string]kubeconfigCertificate{}
+	for _, u := range config.Users {
+		clients[u.Name] = kubeconfigCertificate{data: u.User.ClientCertificateData, file: u.User.ClientCertificate}
+	}
+
+	result := &loadResult{}
+	dir := filepath.Dir(path)
+	add := func(c kubeconfigCertificate, key string, tags map[string]string) error {
+		var pemData []byte
+		switch {
+		case c.data != "":
+			var err error
+			if pemData, err = base64.StdEncoding.DecodeString(c.data); err != nil {
+				return fmt.Errorf("error decoding %s-data: %v", key, err)
+			}
+			key += "-data"
+		case c.file != "":
+			file := c.file
+			if !filepath.IsAbs(file) {
+				file = filepath.Join(dir, file)
+			}
+			var err error
+			if pemData, err = os.ReadFile(file); err != nil {
+				return fmt.Errorf("error reading %s: %v", key, err)
+			}
+		default:
+			return nil
+		}
+		chain, err := decodePEM(pemData)
+		if err != nil {
+			return fmt.Errorf("error decoding %s: %v", key, err)
+		}
+		result.entries = append(result.entries, chainEntries(chain, mergeTags(tags, map[string]string{"key": key}))...)
+		return nil
+	}
+
+	contexts := config.Contexts
+	sort.SliceStable(contexts, func(i, j int) bool {
+		return contexts[i].Name == config.CurrentContext && contexts[j].Name != config.CurrentContext
+	})
+	usedClusters := map[string]bool{}
+	usedUsers := map[string]bool{}
+	for _, c := range contexts {
+		tags := map[string]string{"context": c.Name, "cluster": c.Context.Cluster, "user": c.Context.User}
+		usedClusters[c.Context.Cluster] = true
+		usedUsers[c.Context.User] = true
+		if err := add(clients[c.Context.User], "client-certificate", tags); err != nil {
+			return nil, fmt.Errorf("context %s: %v", c.Name, err)
+		}
+		if err := add(cas[c.Context.Cluster], "certificate-authority", tags); err != nil {
+			return nil, fmt.Errorf("context %s: %v", c.Name, err)
+		}
+	}
+	for _, u := range config.Users {
+		if usedUsers[u.Name] {
+			continue
+		}
+		if err := add(clients[u.Name], "client-certificate", map[string]string{"user": u.Name}); err != nil {
+			return nil, fmt.Errorf("user %s: %v", u.Name, err)
+		}
+	}
+	for _, c := range config.Clusters {
+		if usedClusters[c.Name] {
+			continue
+		}
+		if err := add(cas[c.Name], "certificate-authority", map[string]string{"cluster": c.Name}); err != nil {
+			return nil, fmt.Errorf("cluster %s: %v", c.Name, err)
+		}
+	}
+	if len(result.entries) == 0 {
+		return nil, fmt.Errorf("no certificates found in kubeconfig")
+	}
+	return result, nil
+}
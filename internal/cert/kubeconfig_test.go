@@ -0,0 +1,126 @@
+package cert_test
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sensu/cert-checks/internal/cert"
+	"github.com/sensu/cert-checks/internal/cert/testcert"
+)
+
+func TestCollectMetricsFromKubeconfig(t *testing.T) {
+	ctx := context.Background()
+
+	issuedAt := time.Unix(1<<30, 0)
+	duration := time.Hour * 72
+	ca, caBytes, err := testcert.New("kubernetes", issuedAt, duration)
+	if err != nil {
+		t.Fatalf("could not create CA certificate: %v", err)
+	}
+	adminBytes := issued(t, "admin", issuedAt, duration, ca)
+	kubeletBytes := issued(t, "system:node:worker", issuedAt, time.Hour*24, ca)
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "kubelet.crt"), kubeletBytes, 0644); err != nil {
+		t.Fatalf("could not write certificate: %v", err)
+	}
+	encode := func(b []byte) string { return base64.StdEncoding.EncodeToString(b) }
+	config := fmt.Sprintf(`apiVersion: v1
+kind: Config
+current-context: admin@prod
+clusters:
+- name: prod
+  cluster:
+    server: https://prod.sensu.io:6443
+    certificate-authority-data: %s
+- name: unused
+  cluster:
+    server: https://unused.sensu.io:6443
+    insecure-skip-tls-verify: true
+users:
+- name: kubelet
+  user:
+    client-certificate: kubelet.crt
+    client-key: kubelet.key
+- name: admin
+  user:
+    client-certificate-data: %s
+    client-key-data: %s
+- name: token
+  user:
+    token: secret
+contexts:
+- name: kubelet@prod
+  context:
+    cluster: prod
+    user: kubelet
+- name: admin@prod
+  context:
+    cluster: prod
+    user: admin
+`, encode(caBytes), encode(adminBytes), encode(testcert.SigningKey))
+	configPath := filepath.Join(dir, "config")
+	if err := os.WriteFile(configPath, []byte(config), 0600); err != nil {
+		t.Fatalf("could not write kubeconfig: %v", err)
+	}
+
+	results, err := cert.CollectMetrics(ctx, "kubeconfig://"+configPath, cert.Config{
+		Now: func() time.Time { return issuedAt },
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	type tags = map[string]string
+	expected := []tags{
+		{"context": "admin@prod", "cluster": "prod", "user": "admin", "key": "client-certificate-data", "subject": "admin"},
+		{"context": "admin@prod", "cluster": "prod", "user": "admin", "key": "certificate-authority-data", "subject": "kubernetes"},
+		{"context": "kubelet@prod", "cluster": "prod", "user": "kubelet", "key": "client-certificate", "subject": "system:node:worker"},
+		{"context": "kubelet@prod", "cluster": "prod", "user": "kubelet", "key": "certificate-authority-data", "subject": "kubernetes"},
+	}
+	var actualTags []tags
+	minSeconds := 0
+	for i, m := range results {
+		if i == 0 || m.ChainMinSecondsUntilExpires < minSeconds {
+			minSeconds = m.ChainMinSecondsUntilExpires
+		}
+		c := m.Chain[0]
+		actualTags = append(actualTags, tags{
+			"context": c.Tags["context"],
+			"cluster": c.Tags["cluster"],
+			"user":    c.Tags["user"],
+			"key":     c.Tags["key"],
+			"subject": c.Tags["subject"],
+		})
+	}
+	if !reflect.DeepEqual(actualTags, expected) {
+		t.Errorf("expected tags %v. actual: %v", expected, actualTags)
+	}
+	if minSeconds != int((time.Hour * 24).Seconds()) {
+		t.Errorf("expected ChainMinSecondsUntilExpires to be %d. actual: %d", int((time.Hour * 24).Seconds()), minSeconds)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "kubelet.crt")); err != nil {
+		t.Fatalf("could not remove certificate: %v", err)
+	}
+	if _, err := cert.CollectMetrics(ctx, "kubeconfig://"+configPath, cert.Config{}); err == nil {
+		t.Error("expected error for missing client certificate file")
+	}
+}
+
+// issued returns the PEM encoded leaf of a certificate signed by issuer.
+func issued(t *testing.T, host string, notBefore time.Time, duration time.Duration, issuer tls.Certificate) []byte {
+	t.Helper()
+	leaf, _, err := testcert.NewIssued(host, notBefore, duration, issuer)
+	if err != nil {
+		t.Fatalf("could not create certificate: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Certificate[0]})
+}
@@ -0,0 +1,157 @@
+package cert
+
+import (
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"net"
+)
+
+// ldapStartTLSOID is the request name of the StartTLS extended operation.
+const ldapStartTLSOID = "1.3.6.1.4.1.1466.20037"
+
+const (
+	// ldapExtendedRequestTag is the [APPLICATION 23] ExtendedRequest tag
+	ldapExtendedRequestTag = 23
+	// ldapExtendedResponse is the identifier octet of the constructed
+	// [APPLICATION 24] ExtendedResponse
+	ldapExtendedResponse = 0x78
+)
+
+type ldapRequest struct {
+	MessageID  int
+	ProtocolOp asn1.RawValue
+}
+
+// ldapStartTLS negotiates TLS with the StartTLS extended operation described
+// in RFC 4511.
+func ldapStartTLS(conn net.Conn) error {
+	requestName, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, Bytes: []byte(ldapStartTLSOID)})
+	if err != nil {
+		return err
+	}
+	request, err := asn1.Marshal(ldapRequest{
+		MessageID: 1,
+		ProtocolOp: asn1.RawValue{
+			Class:      asn1.ClassApplication,
+			Tag:        ldapExtendedRequestTag,
+			IsCompound: true,
+			Bytes:      requestName,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+
+	data, err := readBER(conn)
+	if err != nil {
+		return fmt.Errorf("ldap StartTLS: %v", err)
+	}
+	// directory servers may use BER length encodings that encoding/asn1
+	// rejects, so the response is walked element by element
+	_, message, _, err := parseBER(data)
+	if err != nil {
+		return fmt.Errorf("ldap StartTLS: %v", err)
+	}
+	_, _, message, err = parseBER(message)
+	if err != nil {
+		return fmt.Errorf("ldap StartTLS: %v", err)
+	}
+	tag, op, _, err := parseBER(message)
+	if err != nil {
+		return fmt.Errorf("ldap StartTLS: %v", err)
+	}
+	if tag != ldapExtendedResponse {
+		return fmt.Errorf("ldap StartTLS: unexpected response")
+	}
+	_, resultCode, op, err := parseBER(op)
+	if err != nil {
+		return fmt.Errorf("ldap StartTLS: %v", err)
+	}
+	code := 0
+	for _, b := range resultCode {
+		code = code<<8 | int(b)
+	}
+	if code != 0 {
+		var diagnosticMessage []byte
+		if _, _, op, err = parseBER(op); err == nil {
+			_, diagnosticMessage, _, _ = parseBER(op)
+		}
+		return fmt.Errorf("ldap StartTLS: result code %d %s", code, diagnosticMessage)
+	}
+	return nil
+}
+
+// readBER reads a single BER encoded element with a single byte tag.
+func readBER(r io.Reader) ([]byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	length := int(header[1])
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > 4 {
+			return nil, fmt.Errorf("unsupported BER length")
+		}
+		lengthBytes := make([]byte, n)
+		if _, err := io.ReadFull(r, lengthBytes); err != nil {
+			return nil, err
+		}
+		header = append(header, lengthBytes...)
+		var err error
+		if length, err = berLength(lengthBytes); err != nil {
+			return nil, err
+		}
+	}
+	data := make([]byte, len(header)+length)
+	copy(data, header)
+	if _, err := io.ReadFull(r, data[len(header):]); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// maxBERLength bounds the elements read from servers. StartTLS responses are
+// tiny, so anything larger is a broken or hostile server.
+const maxBERLength = 1 << 20
+
+// berLength decodes the bytes of a long form BER length.
+func berLength(lengthBytes []byte) (int, error) {
+	var length uint64
+	for _, b := range lengthBytes {
+		length = length<<8 | uint64(b)
+	}
+	if length > maxBERLength {
+		return 0, fmt.Errorf("BER element of %d bytes exceeds %d bytes", length, maxBERLength)
+	}
+	return int(length), nil
+}
+
+// parseBER splits the first BER element with a single byte tag from data,
+// returning its tag, contents and the remaining data.
+func parseBER(data []byte) (tag byte, contents, rest []byte, err error) {
+	if len(data) < 2 {
+		return 0, nil, nil, fmt.Errorf("truncated BER element")
+	}
+	tag = data[0]
+	length := int(data[1])
+	offset := 2
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > 4 || len(data) < offset+n {
+			return 0, nil, nil, fmt.Errorf("unsupported BER length")
+		}
+		if length, err = berLength(data[offset : offset+n]); err != nil {
+			return 0, nil, nil, err
+		}
+		offset += n
+	}
+	if len(data) < offset+length {
+		return 0, nil, nil, fmt.Errorf("truncated BER element")
+	}
+	return tag, data[offset : offset+length], data[offset+length:], nil
+}
@@ -0,0 +1,116 @@
+package cert_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"testing"
+	"time"
+
+	"github.com/sensu/cert-checks/internal/cert"
+	"github.com/sensu/cert-checks/internal/cert/testcert"
+)
+
+func TestCollectMetricsFromLDAP(t *testing.T) {
+	ctx := context.Background()
+
+	issuedAt := time.Unix(1<<30, 0)
+	duration := time.Hour * 72
+	keyPair, _, err := testcert.New("ldap.sensu.io", issuedAt, duration)
+	if err != nil {
+		t.Fatalf("could not load testcert as x509 key pair: %v", err)
+	}
+
+	startTLSRequest := append([]byte{0x30, 0x1d, 0x02, 0x01, 0x01, 0x77, 0x18, 0x80, 0x16}, "1.3.6.1.4.1.1466.20037"...)
+	startTLS := func(response []byte, accepted bool) func(*textproto.Conn) error {
+		return func(text *textproto.Conn) error {
+			request := make([]byte, len(startTLSRequest))
+			if _, err := io.ReadFull(text.R, request); err != nil {
+				return err
+			}
+			if !bytes.Equal(request, startTLSRequest) {
+				return fmt.Errorf("unexpected request %x", request)
+			}
+			_, _ = text.W.Write(response)
+			_ = text.W.Flush()
+			if !accepted {
+				return fmt.Errorf("StartTLS refused")
+			}
+			return nil
+		}
+	}
+	success := []byte{0x30, 0x0c, 0x02, 0x01, 0x01, 0x78, 0x07, 0x0a, 0x01, 0x00, 0x04, 0x00, 0x04, 0x00}
+	// Active Directory style long form lengths
+	longFormSuccess := []byte{0x30, 0x84, 0x00, 0x00, 0x00, 0x10, 0x02, 0x01, 0x01, 0x78, 0x84, 0x00, 0x00, 0x00, 0x07, 0x0a, 0x01, 0x00, 0x04, 0x00, 0x04, 0x00}
+	oversized := []byte{0x30, 0x84, 0xff, 0xff, 0xff, 0xff, 0x02, 0x01, 0x01}
+	unavailable := []byte{0x30, 0x0c, 0x02, 0x01, 0x01, 0x78, 0x07, 0x0a, 0x01, 0x34, 0x04, 0x00, 0x04, 0x00}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not start test server: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_ = tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{keyPair}}).Handshake()
+			}()
+		}
+	}()
+
+	testCases := []struct {
+		Name      string
+		Cert      func() string
+		ExpectErr bool
+	}{
+		{
+			Name: "ldap StartTLS",
+			Cert: func() string { return "ldap://" + serveSTARTTLS(t, keyPair, startTLS(success, true)) },
+		}, {
+			Name: "ldap StartTLS long form lengths",
+			Cert: func() string { return "ldap://" + serveSTARTTLS(t, keyPair, startTLS(longFormSuccess, true)) },
+		}, {
+			Name:      "ldap StartTLS oversized length",
+			Cert:      func() string { return "ldap://" + serveSTARTTLS(t, keyPair, startTLS(oversized, false)) },
+			ExpectErr: true,
+		}, {
+			Name:      "ldap StartTLS unavailable",
+			Cert:      func() string { return "ldap://" + serveSTARTTLS(t, keyPair, startTLS(unavailable, false)) },
+			ExpectErr: true,
+		}, {
+			Name: "ldaps",
+			Cert: func() string { return "ldaps://" + ln.Addr().String() },
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+			defer cancel()
+			actual, err := collectSingle(t, ctx, tc.Cert(), cert.Config{
+				Now: func() time.Time { return issuedAt },
+			})
+			if err != nil && !tc.ExpectErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if err != nil {
+				return
+			}
+			if tc.ExpectErr {
+				t.Fatal("expected error")
+			}
+			if actual.Tags["subject"] != "ldap.sensu.io" {
+				t.Errorf("expected subject ldap.sensu.io. actual: %s", actual.Tags["subject"])
+			}
+		})
+	}
+}
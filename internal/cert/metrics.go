@@ -0,0 +1,484 @@
+package cert
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const secondsToDays = float64(60 * 60 * 24)
+
+// Metrics collected for a certificate location. SecondsSinceIssued,
+// SecondsUntilExpires and Tags describe the leaf certificate.
+type Metrics struct {
+	EvaluatedAt         time.Time
+	SecondsSinceIssued  int
+	SecondsUntilExpires int
+	Tags                map[string]string
+	// Chain holds the metrics for every certificate presented, leaf first
+	Chain []CertificateMetrics
+	// ChainMinSecondsUntilExpires is the earliest expiry anywhere in the chain
+	ChainMinSecondsUntilExpires int
+	// Verification of the chain, when requested
+	Verification *Verification
+	// KeyMatch reports whether the leaf matches the private key, when one is
+	// given
+	KeyMatch *bool
+	// ClientAuth requested by the server, when reported
+	ClientAuth *ClientAuth
+	// OCSP response of the leaf's responder, when requested
+	OCSP *OCSPResponse
+	// Staple served in the TLS handshake, when requested
+	Staple *Staple
+	// CRL status of the leaf, when requested
+	CRL *CRLStatus
+	// Transparency of the leaf, when requested
+	Transparency *Transparency
+	// TLSAudit of the server, when requested
+	TLSAudit *TLSAudit
+	// Pins evaluated against the chain, when configured
+	Pins []PinMatch
+	// Expectations asserted against the leaf, when configured
+	Expectations []Expectation
+	// Findings are the problems detected while evaluating the certificate
+	Findings []Finding
+	// Err is set when the certificate could not be collected, in which case
+	// there are no certificate metrics
+	Err error
+}
+
+// CertificateMetrics for a single certificate in a chain.
+type CertificateMetrics struct {
+	SecondsSinceIssued  int
+	SecondsUntilExpires int
+	Tags                map[string]string
+	// Strength of the key and signature, when evaluated
+	Strength *Strength
+}
+
+// Status returns the most severe status among the metrics findings.
+func (m Metrics) Status() Status {
+	status := StatusOK
+	for _, f := range m.Findings {
+		if f.Status > status {
+			status = f.Status
+		}
+	}
+	return status
+}
+
+// Output the metrics in prometheus text format.
+func (m Metrics) Output() string {
+	return Output(m)
+}
+
+// Output metrics for any number of certificate locations in prometheus text
+// format, grouping the series of each metric under a single HELP and TYPE.
+func Output(metrics ...Metrics) string {
+	var lines []string
+	for _, f := range families {
+		var series []string
+		for _, m := range metrics {
+			epoch := m.EvaluatedAt.UnixMilli()
+			for _, s := range f.samples(m) {
+				series = append(series, fmt.Sprintf("%s%s %s %d", f.name, formatTags(s.tags), s.value, epoch))
+			}
+		}
+		if len(series) == 0 {
+			continue
+		}
+		lines = append(lines,
+			fmt.Sprintf("# HELP %s %s", f.name, f.help),
+			fmt.Sprintf("# TYPE %s %s", f.name, f.kind),
+		)
+		lines = append(lines, series...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+type sample struct {
+	tags  map[string]string
+	value string
+}
+
+type family struct {
+	name    string
+	help    string
+	kind    string
+	samples func(Metrics) []sample
+}
+
+var families = []family{
+	{
+		name: "cert_days_left",
+		help: "number of days until certificate expires. Expired certificates produce negative numbers.",
+		kind: "gauge",
+		samples: certificateSamples(func(c CertificateMetrics) string {
+			return fmt.Sprintf("%f", float64(c.SecondsUntilExpires)/secondsToDays)
+		}),
+	}, {
+		name: "cert_seconds_left",
+		help: "number of seconds until certificate expires. Expired certificates produce negative numbers.",
+		kind: "gauge",
+		samples: certificateSamples(func(c CertificateMetrics) string {
+			return fmt.Sprintf("%d", c.SecondsUntilExpires)
+		}),
+	}, {
+		name: "cert_issued_days",
+		help: "total number of days since certificate was issued.",
+		kind: "counter",
+		samples: certificateSamples(func(c CertificateMetrics) string {
+			return fmt.Sprintf("%f", float64(c.SecondsSinceIssued)/secondsToDays)
+		}),
+	}, {
+		name: "cert_issued_seconds",
+		help: "total number of seconds since the certificate was issued.",
+		kind: "counter",
+		samples: certificateSamples(func(c CertificateMetrics) string {
+			return fmt.Sprintf("%d", c.SecondsSinceIssued)
+		}),
+	}, {
+		name: "cert_chain_min_seconds_left",
+		help: "number of seconds until the first certificate in the chain expires.",
+		kind: "gauge",
+		samples: func(m Metrics) []sample {
+			if len(m.Chain) == 0 {
+				return nil
+			}
+			return []sample{{tags: m.Tags, value: fmt.Sprintf("%d", m.ChainMinSecondsUntilExpires)}}
+		},
+	}, {
+		name: "cert_chain_valid",
+		help: "1 when the certificate chain verifies against the trusted roots, 0 otherwise.",
+		kind: "gauge",
+		samples: func(m Metrics) []sample {
+			if m.Verification == nil {
+				return nil
+			}
+			return []sample{{tags: m.Tags, value: boolValue(m.Verification.Valid)}}
+		},
+	}, {
+		name: "cert_key_match",
+		help: "1 when the certificate public key matches the private key, 0 otherwise.",
+		kind: "gauge",
+		samples: func(m Metrics) []sample {
+			if m.KeyMatch == nil {
+				return nil
+			}
+			return []sample{{tags: m.Tags, value: boolValue(*m.KeyMatch)}}
+		},
+	}, {
+		name: "cert_pin_match",
+		help: "1 when the pin matches a certificate of the chain, 0 otherwise.",
+		kind: "gauge",
+		samples: func(m Metrics) []sample {
+			samples := make([]sample, 0, len(m.Pins))
+			for _, p := range m.Pins {
+				tags := mergeTags(m.Tags, map[string]string{"pin": p.Pin.String(), "pin_type": p.Pin.Kind})
+				samples = append(samples, sample{tags: tags, value: boolValue(p.Matched)})
+			}
+			return samples
+		},
+	}, {
+		name: "cert_expectation_met",
+		help: "1 when the leaf certificate meets the expectation, 0 otherwise.",
+		kind: "gauge",
+		samples: func(m Metrics) []sample {
+			samples := make([]sample, 0, len(m.Expectations))
+			for _, e := range m.Expectations {
+				tags := mergeTags(m.Tags, map[string]string{"expectation": e.Name})
+				samples = append(samples, sample{tags: tags, value: boolValue(e.Met)})
+			}
+			return samples
+		},
+	}, {
+		name: "cert_client_auth_requested",
+		help: "1 when the server requested a client certificate, 0 otherwise.",
+		kind: "gauge",
+		samples: func(m Metrics) []sample {
+			if m.ClientAuth == nil {
+				return nil
+			}
+			return []sample{{tags: m.Tags, value: boolValue(m.ClientAuth.Requested)}}
+		},
+	}, {
+		name: "cert_client_auth_ca",
+		help: "certificate authorities the server accepts client certificates from.",
+		kind: "gauge",
+		samples: func(m Metrics) []sample {
+			if m.ClientAuth == nil {
+				return nil
+			}
+			samples := make([]sample, 0, len(m.ClientAuth.AcceptableCAs))
+			for _, ca := range m.ClientAuth.AcceptableCAs {
+				samples = append(samples, sample{tags: mergeTags(m.Tags, map[string]string{"ca": ca}), value: "1"})
+			}
+			return samples
+		},
+	}, {
+		name: "cert_ocsp_status",
+		help: "OCSP status of the certificate. 0 for good, 1 for revoked and 2 for unknown.",
+		kind: "gauge",
+		samples: func(m Metrics) []sample {
+			if m.OCSP == nil || m.OCSP.Err != nil {
+				return nil
+			}
+			return []sample{{tags: mergeTags(m.Tags, map[string]string{"status": m.OCSP.StatusName()}), value: fmt.Sprintf("%d", m.OCSP.Status)}}
+		},
+	}, {
+		name: "cert_ocsp_revoked_timestamp",
+		help: "unix time in seconds at which the certificate was revoked according to OCSP.",
+		kind: "gauge",
+		samples: func(m Metrics) []sample {
+			if m.OCSP == nil || m.OCSP.Err != nil || m.OCSP.RevokedAt.IsZero() {
+				return nil
+			}
+			return []sample{{tags: m.Tags, value: fmt.Sprintf("%d", m.OCSP.RevokedAt.Unix())}}
+		},
+	}, {
+		name: "cert_ocsp_seconds_until_next_update",
+		help: "number of seconds until the OCSP response is updated. Stale responses produce negative numbers.",
+		kind: "gauge",
+		samples: func(m Metrics) []sample {
+			if m.OCSP == nil || m.OCSP.Err != nil || m.OCSP.NextUpdate.IsZero() {
+				return nil
+			}
+			return []sample{{tags: m.Tags, value: fmt.Sprintf("%d", int(m.OCSP.NextUpdate.Sub(m.EvaluatedAt).Seconds()))}}
+		},
+	}, {
+		name: "cert_ocsp_staple_present",
+		help: "1 when the server stapled an OCSP response, 0 otherwise.",
+		kind: "gauge",
+		samples: func(m Metrics) []sample {
+			if m.Staple == nil {
+				return nil
+			}
+			return []sample{{tags: m.Tags, value: boolValue(m.Staple.Present)}}
+		},
+	}, {
+		name: "cert_ocsp_staple_status",
+		help: "OCSP status of the certificate in the stapled response. 0 for good, 1 for revoked and 2 for unknown.",
+		kind: "gauge",
+		samples: func(m Metrics) []sample {
+			if m.Staple == nil || m.Staple.Response == nil || m.Staple.Response.Err != nil {
+				return nil
+			}
+			r := m.Staple.Response
+			return []sample{{tags: mergeTags(m.Tags, map[string]string{"status": r.StatusName()}), value: fmt.Sprintf("%d", r.Status)}}
+		},
+	}, {
+		name: "cert_ocsp_staple_seconds_until_next_update",
+		help: "number of seconds until the stapled OCSP response is updated. Stale staples produce negative numbers.",
+		kind: "gauge",
+		samples: func(m Metrics) []sample {
+			if m.Staple == nil || m.Staple.Response == nil || m.Staple.Response.Err != nil || m.Staple.Response.NextUpdate.IsZero() {
+				return nil
+			}
+			return []sample{{tags: m.Tags, value: fmt.Sprintf("%d", int(m.Staple.Response.NextUpdate.Sub(m.EvaluatedAt).Seconds()))}}
+		},
+	}, {
+		name: "cert_crl_revoked",
+		help: "1 when the certificate is listed in its issuer's CRL, 0 otherwise.",
+		kind: "gauge",
+		samples: func(m Metrics) []sample {
+			if m.CRL == nil || m.CRL.Err != nil {
+				return nil
+			}
+			return []sample{{tags: m.Tags, value: boolValue(m.CRL.Revoked)}}
+		},
+	}, {
+		name: "crl_seconds_until_next_update",
+		help: "number of seconds until the CRL is updated. Expired CRLs produce negative numbers.",
+		kind: "gauge",
+		samples: func(m Metrics) []sample {
+			if m.CRL == nil || m.CRL.Err != nil || m.CRL.NextUpdate.IsZero() {
+				return nil
+			}
+			return []sample{{tags: m.Tags, value: fmt.Sprintf("%d", int(m.CRL.NextUpdate.Sub(m.EvaluatedAt).Seconds()))}}
+		},
+	}, {
+		name: "cert_sct_count",
+		help: "number of signed certificate timestamps for the certificate.",
+		kind: "gauge",
+		samples: func(m Metrics) []sample {
+			if m.Transparency == nil {
+				return nil
+			}
+			return []sample{{tags: m.Tags, value: fmt.Sprintf("%d", len(m.Transparency.SCTs))}}
+		},
+	}, {
+		name: "cert_sct_logs",
+		help: "number of distinct logs with a signed certificate timestamp for the certificate, counting only valid ones when verified.",
+		kind: "gauge",
+		samples: func(m Metrics) []sample {
+			if m.Transparency == nil {
+				return nil
+			}
+			return []sample{{tags: m.Tags, value: fmt.Sprintf("%d", m.Transparency.Logs)}}
+		},
+	}, {
+		name: "cert_sct",
+		help: "signed certificate timestamps by log and source. 0 when verification failed.",
+		kind: "gauge",
+		samples: func(m Metrics) []sample {
+			if m.Transparency == nil {
+				return nil
+			}
+			samples := make([]sample, 0, len(m.Transparency.SCTs))
+			for _, s := range m.Transparency.SCTs {
+				tags := map[string]string{"log_id": s.LogID, "source": s.Source}
+				if s.Log != "" {
+					tags["log"] = s.Log
+				}
+				samples = append(samples, sample{tags: mergeTags(m.Tags, tags), value: boolValue(s.Valid == nil || *s.Valid)})
+			}
+			return samples
+		},
+	}, {
+		name: "cert_key_bits",
+		help: "size of the certificate public key in bits.",
+		kind: "gauge",
+		samples: strengthSamples(func(s *Strength) (map[string]string, string) {
+			return map[string]string{"key_algorithm": s.KeyAlgorithm}, fmt.Sprintf("%d", s.KeyBits)
+		}),
+	}, {
+		name: "cert_signature_algorithm",
+		help: "algorithm the certificate is signed with.",
+		kind: "gauge",
+		samples: strengthSamples(func(s *Strength) (map[string]string, string) {
+			return map[string]string{"signature_algorithm": s.SignatureAlgorithm}, "1"
+		}),
+	}, {
+		name: "cert_weak_crypto",
+		help: "1 when the certificate key or signature violates the crypto policy, 0 otherwise.",
+		kind: "gauge",
+		samples: strengthSamples(func(s *Strength) (map[string]string, string) {
+			return nil, boolValue(s.Weak)
+		}),
+	}, {
+		name: "cert_tls_version_accepted",
+		help: "1 when the server accepts the TLS protocol version, 0 otherwise.",
+		kind: "gauge",
+		samples: func(m Metrics) []sample {
+			if m.TLSAudit == nil || m.TLSAudit.Err != nil {
+				return nil
+			}
+			samples := make([]sample, 0, len(m.TLSAudit.Versions))
+			for _, va := range m.TLSAudit.Versions {
+				tags := mergeTags(m.Tags, map[string]string{"tls_version": TLSVersionName(va.Version)})
+				samples = append(samples, sample{tags: tags, value: boolValue(va.Accepted)})
+			}
+			return samples
+		},
+	}, {
+		name: "cert_tls_cipher_suite_accepted",
+		help: "cipher suites the server accepts by TLS protocol version.",
+		kind: "gauge",
+		samples: func(m Metrics) []sample {
+			if m.TLSAudit == nil || m.TLSAudit.Err != nil {
+				return nil
+			}
+			var samples []sample
+			for _, va := range m.TLSAudit.Versions {
+				for _, s := range va.CipherSuites {
+					tags := mergeTags(m.Tags, map[string]string{
+						"tls_version":  TLSVersionName(va.Version),
+						"cipher_suite": tls.CipherSuiteName(s),
+					})
+					samples = append(samples, sample{tags: tags, value: "1"})
+				}
+			}
+			return samples
+		},
+	}, {
+		name: "cert_collect_error",
+		help: "1 when the certificate could not be collected, labelled with the reason.",
+		kind: "gauge",
+		samples: func(m Metrics) []sample {
+			if m.Err == nil {
+				return nil
+			}
+			return []sample{{tags: mergeTags(m.Tags, map[string]string{"reason": ErrorReason(m.Err)}), value: "1"}}
+		},
+	},
+}
+
+func boolValue(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+// certificateSamples produces a sample per certificate in the chain. Metrics
+// without a chain are treated as a single certificate.
+func certificateSamples(value func(CertificateMetrics) string) func(Metrics) []sample {
+	return func(m Metrics) []sample {
+		if m.Err != nil {
+			return nil
+		}
+		if len(m.Chain) == 0 {
+			c := CertificateMetrics{
+				SecondsSinceIssued:  m.SecondsSinceIssued,
+				SecondsUntilExpires: m.SecondsUntilExpires,
+			}
+			return []sample{{tags: m.Tags, value: value(c)}}
+		}
+		samples := make([]sample, 0, len(m.Chain))
+		for _, c := range m.Chain {
+			samples = append(samples, sample{tags: mergeTags(m.Tags, c.Tags), value: value(c)})
+		}
+		return samples
+	}
+}
+
+// strengthSamples produces a sample per certificate of the chain with an
+// evaluated strength, adding the tags returned by value.
+func strengthSamples(value func(*Strength) (map[string]string, string)) func(Metrics) []sample {
+	return func(m Metrics) []sample {
+		var samples []sample
+		for _, c := range m.Chain {
+			if c.Strength == nil {
+				continue
+			}
+			tags, v := value(c.Strength)
+			samples = append(samples, sample{tags: mergeTags(mergeTags(m.Tags, c.Tags), tags), value: v})
+		}
+		return samples
+	}
+}
+
+// mergeTags returns the union of both tag sets, preferring values from override.
+func mergeTags(base, override map[string]string) map[string]string {
+	tags := make(map[string]string, len(base)+len(override))
+	for k, v := range base {
+		tags[k] = v
+	}
+	for k, v := range override {
+		tags[k] = v
+	}
+	return tags
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatTags(tags map[string]string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	buf := bytes.Buffer{}
+	separator := ""
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "%s%s=\"%s\"", separator, k, labelEscaper.Replace(tags[k]))
+		separator = ", "
+	}
+	return fmt.Sprintf("{%s}", buf.String())
+}
@@ -3,6 +3,8 @@
 package cert_test
 
 import (
+	"errors"
+	"strings"
 	"testing"
 	"time"
 
@@ -59,3 +61,109 @@ cert_issued_seconds{servername="sensu.io"} 100 42000`
 		t.Errorf("Unexpected output. Wanted:\n%s\n Got:\n%s", expected, actual)
 	}
 }
+
+func TestMetricsOutputChain(t *testing.T) {
+	m := cert.Metrics{
+		EvaluatedAt:                 time.Unix(42, 0),
+		SecondsSinceIssued:          100,
+		SecondsUntilExpires:         2000,
+		Tags:                        map[string]string{"subject": "sensu.io", "servername": "sensu.io"},
+		ChainMinSecondsUntilExpires: 1000,
+		Chain: []cert.CertificateMetrics{
+			{
+				SecondsSinceIssued:  100,
+				SecondsUntilExpires: 2000,
+				Tags:                map[string]string{"index": "0", "subject": "sensu.io", "issuer": "Test \"CA\""},
+			}, {
+				SecondsSinceIssued:  200,
+				SecondsUntilExpires: 1000,
+				Tags:                map[string]string{"index": "1", "subject": "Test \"CA\"", "issuer": "Test \"CA\""},
+			},
+		},
+	}
+	actual := m.Output()
+
+	expected := `# HELP cert_days_left number of days until certificate expires. Expired certificates produce negative numbers.
+# TYPE cert_days_left gauge
+cert_days_left{index="0", issuer="Test \"CA\"", servername="sensu.io", subject="sensu.io"} 0.023148 42000
+cert_days_left{index="1", issuer="Test \"CA\"", servername="sensu.io", subject="Test \"CA\""} 0.011574 42000
+# HELP cert_seconds_left number of seconds until certificate expires. Expired certificates produce negative numbers.
+# TYPE cert_seconds_left gauge
+cert_seconds_left{index="0", issuer="Test \"CA\"", servername="sensu.io", subject="sensu.io"} 2000 42000
+cert_seconds_left{index="1", issuer="Test \"CA\"", servername="sensu.io", subject="Test \"CA\""} 1000 42000
+# HELP cert_issued_days total number of days since certificate was issued.
+# TYPE cert_issued_days counter
+cert_issued_days{index="0", issuer="Test \"CA\"", servername="sensu.io", subject="sensu.io"} 0.001157 42000
+cert_issued_days{index="1", issuer="Test \"CA\"", servername="sensu.io", subject="Test \"CA\""} 0.002315 42000
+# HELP cert_issued_seconds total number of seconds since the certificate was issued.
+# TYPE cert_issued_seconds counter
+cert_issued_seconds{index="0", issuer="Test \"CA\"", servername="sensu.io", subject="sensu.io"} 100 42000
+cert_issued_seconds{index="1", issuer="Test \"CA\"", servername="sensu.io", subject="Test \"CA\""} 200 42000
+# HELP cert_chain_min_seconds_left number of seconds until the first certificate in the chain expires.
+# TYPE cert_chain_min_seconds_left gauge
+cert_chain_min_seconds_left{servername="sensu.io", subject="sensu.io"} 1000 42000`
+	if actual != expected {
+		t.Errorf("Unexpected output. Wanted:\n%s\n Got:\n%s", expected, actual)
+	}
+}
+
+func TestOutputCollectError(t *testing.T) {
+	ok := cert.Metrics{
+		EvaluatedAt:         time.Unix(42, 0),
+		SecondsSinceIssued:  100,
+		SecondsUntilExpires: 2000,
+		Tags:                map[string]string{"target": "file:///a.pem"},
+	}
+	failed := cert.Metrics{
+		EvaluatedAt: time.Unix(42, 0),
+		Tags:        map[string]string{"target": "file:///b.pem"},
+		Err:         &cert.CollectError{Reason: cert.ReasonLoad, Err: errors.New("file not found: /b.pem")},
+	}
+	actual := cert.Output(ok, failed)
+
+	expected := `# HELP cert_days_left number of days until certificate expires. Expired certificates produce negative numbers.
+# TYPE cert_days_left gauge
+cert_days_left{target="file:///a.pem"} 0.023148 42000
+# HELP cert_seconds_left number of seconds until certificate expires. Expired certificates produce negative numbers.
+# TYPE cert_seconds_left gauge
+cert_seconds_left{target="file:///a.pem"} 2000 42000
+# HELP cert_issued_days total number of days since certificate was issued.
+# TYPE cert_issued_days counter
+cert_issued_days{target="file:///a.pem"} 0.001157 42000
+# HELP cert_issued_seconds total number of seconds since the certificate was issued.
+# TYPE cert_issued_seconds counter
+cert_issued_seconds{target="file:///a.pem"} 100 42000
+# HELP cert_collect_error 1 when the certificate could not be collected, labelled with the reason.
+# TYPE cert_collect_error gauge
+cert_collect_error{reason="load", target="file:///b.pem"} 1 42000`
+	if actual != expected {
+		t.Errorf("Unexpected output. Wanted:\n%s\n Got:\n%s", expected, actual)
+	}
+}
+
+func TestOutputOCSP(t *testing.T) {
+	m := cert.Metrics{
+		EvaluatedAt:         time.Unix(42, 0),
+		SecondsUntilExpires: 2000,
+		Tags:                map[string]string{"subject": "sensu.io"},
+		OCSP: &cert.OCSPResponse{
+			Status:     1,
+			RevokedAt:  time.Unix(30, 0),
+			NextUpdate: time.Unix(3642, 0),
+		},
+	}
+	actual := m.Output()
+
+	expected := `# HELP cert_ocsp_status OCSP status of the certificate. 0 for good, 1 for revoked and 2 for unknown.
+# TYPE cert_ocsp_status gauge
+cert_ocsp_status{status="revoked", subject="sensu.io"} 1 42000
+# HELP cert_ocsp_revoked_timestamp unix time in seconds at which the certificate was revoked according to OCSP.
+# TYPE cert_ocsp_revoked_timestamp gauge
+cert_ocsp_revoked_timestamp{subject="sensu.io"} 30 42000
+# HELP cert_ocsp_seconds_until_next_update number of seconds until the OCSP response is updated. Stale responses produce negative numbers.
+# TYPE cert_ocsp_seconds_until_next_update gauge
+cert_ocsp_seconds_until_next_update{subject="sensu.io"} 3600 42000`
+	if !strings.HasSuffix(actual, expected) {
+		t.Errorf("Unexpected output. Wanted suffix:\n%s\n Got:\n%s", expected, actual)
+	}
+}
@@ -0,0 +1,193 @@
+package cert
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// maxOCSPResponseSize bounds the responses read from OCSP responders.
+const maxOCSPResponseSize = 1 << 20
+
+// OCSPResponse summarises an OCSP response for the leaf certificate.
+type OCSPResponse struct {
+	// Status is ocsp.Good, ocsp.Revoked or ocsp.Unknown
+	Status int
+	// RevokedAt is set when the certificate is revoked
+	RevokedAt time.Time
+	// NextUpdate is when newer information will be available, zero when the
+	// responder does not say
+	NextUpdate time.Time
+	// Err is set when no valid response was obtained
+	Err error
+}
+
+// ocspStatusNames of the certificate statuses of OCSP responses.
+var ocspStatusNames = map[int]string{
+	ocsp.Good:    "good",
+	ocsp.Revoked: "revoked",
+	ocsp.Unknown: "unknown",
+}
+
+// StatusName of the certificate status, good, revoked or unknown.
+func (r *OCSPResponse) StatusName() string {
+	return ocspStatusNames[r.Status]
+}
+
+// Staple describes the OCSP response stapled to a TLS handshake.
+type Staple struct {
+	// Present is set when the server stapled a response
+	Present bool
+	// Response is the parsed staple, when present
+	Response *OCSPResponse
+}
+
+// oidTLSFeature identifies the TLS Feature extension of RFC 7633, which holds
+// the OCSP Must-Staple requirement.
+var oidTLSFeature = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}
+
+// tlsFeatureStatusRequest is the status_request TLS extension.
+const tlsFeatureStatusRequest = 5
+
+// parseStaple validates a stapled OCSP response against the leaf and its
+// issuer from the chain.
+func parseStaple(chain []*x509.Certificate, staple []byte) *Staple {
+	if len(staple) == 0 {
+		return &Staple{}
+	}
+	issuer, err := findIssuer(chain)
+	if err != nil {
+		return &Staple{Present: true, Response: &OCSPResponse{Err: err}}
+	}
+	resp, err := ocsp.ParseResponseForCert(staple, chain[0], issuer)
+	if err != nil {
+		return &Staple{Present: true, Response: &OCSPResponse{Err: fmt.Errorf("invalid OCSP staple: %v", err)}}
+	}
+	return &Staple{Present: true, Response: newOCSPResponse(resp)}
+}
+
+// mustStaple reports whether the certificate requires OCSP stapling.
+func mustStaple(cert *x509.Certificate) bool {
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidTLSFeature) {
+			continue
+		}
+		var features []int
+		if _, err := asn1.Unmarshal(ext.Value, &features); err != nil {
+			return false
+		}
+		for _, f := range features {
+			if f == tlsFeatureStatusRequest {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// findIssuer of the leaf among the other certificates of the chain.
+func findIssuer(chain []*x509.Certificate) (*x509.Certificate, error) {
+	for _, c := range chain[1:] {
+		if chain[0].CheckSignatureFrom(c) == nil {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("issuer of %s not found in chain", name(chain[0].Subject))
+}
+
+// queryOCSP asks the leaf's OCSP responders for its status, using the first
+// valid response.
+func queryOCSP(ctx context.Context, chain []*x509.Certificate) *OCSPResponse {
+	leaf := chain[0]
+	if len(leaf.OCSPServer) == 0 {
+		return &OCSPResponse{Err: fmt.Errorf("certificate has no OCSP responder")}
+	}
+	issuer, err := findIssuer(chain)
+	if err != nil {
+		return &OCSPResponse{Err: err}
+	}
+	req, err := ocsp.CreateRequest(leaf, issuer, &ocsp.RequestOptions{Hash: crypto.SHA1})
+	if err != nil {
+		return &OCSPResponse{Err: fmt.Errorf("error creating OCSP request: %v", err)}
+	}
+	for _, server := range leaf.OCSPServer {
+		var resp *ocsp.Response
+		if resp, err = postOCSP(ctx, server, req, leaf, issuer); err == nil {
+			return newOCSPResponse(resp)
+		}
+	}
+	return &OCSPResponse{Err: err}
+}
+
+func postOCSP(ctx context.Context, server string, req []byte, leaf, issuer *x509.Certificate) (*ocsp.Response, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, server, bytes.NewReader(req))
+	if err != nil {
+		return nil, fmt.Errorf("error requesting OCSP status from %s: %v", server, err)
+	}
+	httpReq.Header.Set("Content-Type", "application/ocsp-request")
+	httpReq.Header.Set("Accept", "application/ocsp-response")
+	httpResp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("error requesting OCSP status from %s: %v", server, err)
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error requesting OCSP status from %s: %s", server, httpResp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(httpResp.Body, maxOCSPResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("error reading OCSP response from %s: %v", server, err)
+	}
+	resp, err := ocsp.ParseResponseForCert(body, leaf, issuer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OCSP response from %s: %v", server, err)
+	}
+	return resp, nil
+}
+
+func newOCSPResponse(resp *ocsp.Response) *OCSPResponse {
+	return &OCSPResponse{
+		Status:     resp.Status,
+		RevokedAt:  resp.RevokedAt,
+		NextUpdate: resp.NextUpdate,
+	}
+}
+
+// evaluateOCSP reports revoked and unknown certificates, stale responses, and
+// failures to obtain a response. source names where the response came from.
+func evaluateOCSP(subject, source string, r *OCSPResponse, now time.Time) []Finding {
+	if r.Err != nil {
+		return []Finding{{
+			Status:  StatusWarning,
+			Message: fmt.Sprintf("%s check failed: %v", source, r.Err),
+		}}
+	}
+	var findings []Finding
+	switch r.Status {
+	case ocsp.Revoked:
+		findings = append(findings, Finding{
+			Status:  StatusCritical,
+			Message: fmt.Sprintf("certificate %s was revoked at %s", subject, r.RevokedAt.UTC().Format(time.RFC3339)),
+		})
+	case ocsp.Unknown:
+		findings = append(findings, Finding{
+			Status:  StatusWarning,
+			Message: fmt.Sprintf("%s status of certificate %s is unknown", source, subject),
+		})
+	}
+	if !r.NextUpdate.IsZero() && r.NextUpdate.Before(now) {
+		findings = append(findings, Finding{
+			Status:  StatusWarning,
+			Message: fmt.Sprintf("%s for certificate %s is stale since %s", source, subject, r.NextUpdate.UTC().Format(time.RFC3339)),
+		})
+	}
+	return findings
+}
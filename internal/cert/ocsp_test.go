@@ -0,0 +1,314 @@
+package cert_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/sensu/cert-checks/internal/cert"
+	"github.com/sensu/cert-checks/internal/cert/testcert"
+)
+
+// ocspResponder is a stand-in OCSP responder answering with the status held
+// for each serial number, signed by signer.
+type ocspResponder struct {
+	t        *testing.T
+	issuer   *x509.Certificate
+	signer   crypto.Signer
+	statuses map[string]int
+	now      time.Time
+}
+
+func (o *ocspResponder) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		o.t.Errorf("could not read OCSP request: %v", err)
+		return
+	}
+	req, err := ocsp.ParseRequest(body)
+	if err != nil {
+		o.t.Errorf("could not parse OCSP request: %v", err)
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	resp, err := ocspResponse(o.issuer, o.signer, req.SerialNumber, o.statuses[req.SerialNumber.Text(16)], o.now)
+	if err != nil {
+		o.t.Errorf("could not create OCSP response: %v", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/ocsp-response")
+	_, _ = rw.Write(resp)
+}
+
+// ocspResponse signed by the issuer, valid for a day from now.
+func ocspResponse(issuer *x509.Certificate, signer crypto.Signer, serial *big.Int, status int, now time.Time) ([]byte, error) {
+	template := ocsp.Response{
+		Status:       status,
+		SerialNumber: serial,
+		ThisUpdate:   now,
+		NextUpdate:   now.Add(time.Hour * 24),
+	}
+	if status == ocsp.Revoked {
+		template.RevokedAt = now.Add(-time.Hour)
+		template.RevocationReason = ocsp.KeyCompromise
+	}
+	return ocsp.CreateResponse(issuer, issuer, template, signer)
+}
+
+func TestCollectMetricsOCSP(t *testing.T) {
+	ctx := context.Background()
+
+	issuedAt := time.Unix(1<<30, 0)
+	duration := time.Hour * 72
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate CA key: %v", err)
+	}
+	ca, _, err := testcert.NewWithKey("ca.sensu.io", issuedAt, duration, caKey)
+	if err != nil {
+		t.Fatalf("could not create CA certificate: %v", err)
+	}
+	caCert, err := x509.ParseCertificate(ca.Certificate[0])
+	if err != nil {
+		t.Fatalf("could not parse CA certificate: %v", err)
+	}
+	imposterKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate key: %v", err)
+	}
+
+	responder := &ocspResponder{t: t, issuer: caCert, signer: caKey, statuses: map[string]int{}, now: issuedAt}
+	srv := httptest.NewServer(responder)
+	defer srv.Close()
+	imposter := httptest.NewServer(&ocspResponder{t: t, issuer: caCert, signer: imposterKey, now: issuedAt})
+	defer imposter.Close()
+
+	dir := t.TempDir()
+	issue := func(host string, status int, responders ...string) string {
+		pair, chainBytes, err := testcert.NewIssued(host, issuedAt, duration, ca, func(c *x509.Certificate) {
+			c.OCSPServer = responders
+		})
+		if err != nil {
+			t.Fatalf("could not create certificate: %v", err)
+		}
+		leaf, err := x509.ParseCertificate(pair.Certificate[0])
+		if err != nil {
+			t.Fatalf("could not parse certificate: %v", err)
+		}
+		responder.statuses[leaf.SerialNumber.Text(16)] = status
+		path := filepath.Join(dir, host+".pem")
+		if err := os.WriteFile(path, chainBytes, 0644); err != nil {
+			t.Fatalf("could not write certificate: %v", err)
+		}
+		return "file://" + path
+	}
+
+	testCases := []struct {
+		Name           string
+		Cert           string
+		Now            time.Time
+		ExpectedStatus cert.Status
+		ExpectedOCSP   int
+		ExpectErr      bool
+	}{
+		{
+			Name:           "good",
+			Cert:           issue("good.sensu.io", ocsp.Good, srv.URL),
+			Now:            issuedAt,
+			ExpectedStatus: cert.StatusOK,
+			ExpectedOCSP:   ocsp.Good,
+		}, {
+			Name:           "revoked",
+			Cert:           issue("revoked.sensu.io", ocsp.Revoked, srv.URL),
+			Now:            issuedAt,
+			ExpectedStatus: cert.StatusCritical,
+			ExpectedOCSP:   ocsp.Revoked,
+		}, {
+			Name:           "unknown",
+			Cert:           issue("unknown.sensu.io", ocsp.Unknown, srv.URL),
+			Now:            issuedAt,
+			ExpectedStatus: cert.StatusWarning,
+			ExpectedOCSP:   ocsp.Unknown,
+		}, {
+			Name:           "stale response",
+			Cert:           issue("stale.sensu.io", ocsp.Good, srv.URL),
+			Now:            issuedAt.Add(time.Hour * 48),
+			ExpectedStatus: cert.StatusWarning,
+			ExpectedOCSP:   ocsp.Good,
+		}, {
+			Name:           "falls back to second responder",
+			Cert:           issue("fallback.sensu.io", ocsp.Good, imposter.URL, srv.URL),
+			Now:            issuedAt,
+			ExpectedStatus: cert.StatusOK,
+			ExpectedOCSP:   ocsp.Good,
+		}, {
+			Name:           "invalid response signature",
+			Cert:           issue("imposter.sensu.io", ocsp.Good, imposter.URL),
+			Now:            issuedAt,
+			ExpectedStatus: cert.StatusWarning,
+			ExpectErr:      true,
+		}, {
+			Name:           "no responder",
+			Cert:           issue("none.sensu.io", ocsp.Good),
+			Now:            issuedAt,
+			ExpectedStatus: cert.StatusWarning,
+			ExpectErr:      true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			actual, err := collectSingle(t, ctx, tc.Cert, cert.Config{
+				Now:  func() time.Time { return tc.Now },
+				OCSP: true,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if actual.OCSP == nil {
+				t.Fatal("expected OCSP response")
+			}
+			if tc.ExpectErr != (actual.OCSP.Err != nil) {
+				t.Errorf("unexpected OCSP error %v", actual.OCSP.Err)
+			}
+			if !tc.ExpectErr && actual.OCSP.Status != tc.ExpectedOCSP {
+				t.Errorf("expected OCSP status %d. actual: %d", tc.ExpectedOCSP, actual.OCSP.Status)
+			}
+			if status := actual.Status(); status != tc.ExpectedStatus {
+				t.Errorf("expected status %v. actual: %v (%v)", tc.ExpectedStatus, status, actual.Findings)
+			}
+		})
+	}
+}
+
+func TestCollectMetricsOCSPStaple(t *testing.T) {
+	ctx := context.Background()
+
+	issuedAt := time.Now().Add(-time.Hour)
+	duration := time.Hour * 72
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate CA key: %v", err)
+	}
+	ca, _, err := testcert.NewWithKey("ca.sensu.io", issuedAt, duration, caKey)
+	if err != nil {
+		t.Fatalf("could not create CA certificate: %v", err)
+	}
+	caCert, err := x509.ParseCertificate(ca.Certificate[0])
+	if err != nil {
+		t.Fatalf("could not parse CA certificate: %v", err)
+	}
+	mustStaple := func(c *x509.Certificate) {
+		// TLS Feature extension with status_request
+		c.ExtraExtensions = append(c.ExtraExtensions, pkix.Extension{
+			Id:    asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24},
+			Value: []byte{0x30, 0x03, 0x02, 0x01, 0x05},
+		})
+	}
+
+	serve := func(status int, staple bool, opts ...testcert.Option) string {
+		pair, _, err := testcert.NewIssued("staple.sensu.io", issuedAt, duration, ca, opts...)
+		if err != nil {
+			t.Fatalf("could not create certificate: %v", err)
+		}
+		if staple {
+			leaf, err := x509.ParseCertificate(pair.Certificate[0])
+			if err != nil {
+				t.Fatalf("could not parse certificate: %v", err)
+			}
+			if pair.OCSPStaple, err = ocspResponse(caCert, caKey, leaf.SerialNumber, status, issuedAt); err != nil {
+				t.Fatalf("could not create OCSP response: %v", err)
+			}
+		}
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+		srv.TLS = &tls.Config{Certificates: []tls.Certificate{pair}}
+		srv.StartTLS()
+		t.Cleanup(srv.Close)
+		return "tcp://" + srv.Listener.Addr().String()
+	}
+
+	testCases := []struct {
+		Name            string
+		Target          string
+		MustStaple      bool
+		Now             time.Time
+		ExpectedPresent bool
+		ExpectedStatus  cert.Status
+	}{
+		{
+			Name:            "good staple",
+			Target:          serve(ocsp.Good, true),
+			Now:             issuedAt,
+			ExpectedPresent: true,
+			ExpectedStatus:  cert.StatusOK,
+		}, {
+			Name:            "revoked staple",
+			Target:          serve(ocsp.Revoked, true),
+			Now:             issuedAt,
+			ExpectedPresent: true,
+			ExpectedStatus:  cert.StatusCritical,
+		}, {
+			Name:            "stale staple",
+			Target:          serve(ocsp.Good, true),
+			Now:             issuedAt.Add(time.Hour * 48),
+			ExpectedPresent: true,
+			ExpectedStatus:  cert.StatusWarning,
+		}, {
+			Name:           "no staple",
+			Target:         serve(ocsp.Good, false),
+			MustStaple:     true,
+			Now:            issuedAt,
+			ExpectedStatus: cert.StatusOK,
+		}, {
+			Name:           "must staple without staple",
+			Target:         serve(ocsp.Good, false, mustStaple),
+			MustStaple:     true,
+			Now:            issuedAt,
+			ExpectedStatus: cert.StatusCritical,
+		}, {
+			Name:            "must staple with staple",
+			Target:          serve(ocsp.Good, true, mustStaple),
+			MustStaple:      true,
+			Now:             issuedAt,
+			ExpectedPresent: true,
+			ExpectedStatus:  cert.StatusOK,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			actual, err := collectSingle(t, ctx, tc.Target, cert.Config{
+				Now:        func() time.Time { return tc.Now },
+				Staple:     true,
+				MustStaple: tc.MustStaple,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if actual.Staple == nil || actual.Staple.Present != tc.ExpectedPresent {
+				t.Fatalf("expected staple present to be %v. actual: %v", tc.ExpectedPresent, actual.Staple)
+			}
+			if tc.ExpectedPresent && actual.Staple.Response.Err != nil {
+				t.Errorf("unexpected staple error %v", actual.Staple.Response.Err)
+			}
+			if status := actual.Status(); status != tc.ExpectedStatus {
+				t.Errorf("expected status %v. actual: %v (%v)", tc.ExpectedStatus, status, actual.Findings)
+			}
+		})
+	}
+}
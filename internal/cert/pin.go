@@ -0,0 +1,98 @@
+package cert
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Kinds of pin.
+const (
+	// PinSPKI pins the SHA-256 hash of the subject public key info, which
+	// survives renewals that keep the key.
+	PinSPKI = "spki"
+	// PinCertificate pins the SHA-256 fingerprint of the whole certificate.
+	PinCertificate = "cert"
+)
+
+// Pin is a SHA-256 digest expected in the presented chain.
+type Pin struct {
+	Kind   string
+	Digest []byte
+}
+
+// ParsePin parses a SHA-256 digest given as base64, optionally prefixed with
+// sha256/, or as hex, optionally separated by colons.
+func ParsePin(kind, value string) (Pin, error) {
+	pin := Pin{Kind: kind}
+	if kind != PinSPKI && kind != PinCertificate {
+		return pin, fmt.Errorf("unknown pin kind %q", kind)
+	}
+	digest := strings.TrimPrefix(value, "sha256/")
+	if b, err := hex.DecodeString(strings.ReplaceAll(digest, ":", "")); err == nil && len(b) == sha256.Size {
+		pin.Digest = b
+	} else if b, err := base64.StdEncoding.DecodeString(digest); err == nil {
+		pin.Digest = b
+	}
+	if len(pin.Digest) != sha256.Size {
+		return pin, fmt.Errorf("%q is not a base64 or hex encoded SHA-256 digest", value)
+	}
+	return pin, nil
+}
+
+// String formats SPKI pins as sha256/ prefixed base64, as used by HPKP, and
+// certificate pins as hex, as printed by sha256sum.
+func (p Pin) String() string {
+	if p.Kind == PinSPKI {
+		return "sha256/" + base64.StdEncoding.EncodeToString(p.Digest)
+	}
+	return hex.EncodeToString(p.Digest)
+}
+
+// PinMatch reports whether a pin matched a certificate of the chain.
+type PinMatch struct {
+	Pin     Pin
+	Matched bool
+	// Subject of the matching certificate
+	Subject string
+}
+
+// matchPins evaluates every pin against every certificate of the chain.
+func matchPins(chain []*x509.Certificate, pins []Pin) []PinMatch {
+	matches := make([]PinMatch, 0, len(pins))
+	for _, pin := range pins {
+		match := PinMatch{Pin: pin}
+		for _, c := range chain {
+			var digest [sha256.Size]byte
+			if pin.Kind == PinSPKI {
+				digest = sha256.Sum256(c.RawSubjectPublicKeyInfo)
+			} else {
+				digest = sha256.Sum256(c.Raw)
+			}
+			if bytes.Equal(digest[:], pin.Digest) {
+				match.Matched = true
+				match.Subject = name(c.Subject)
+				break
+			}
+		}
+		matches = append(matches, match)
+	}
+	return matches
+}
+
+// evaluatePins is critical when no pin matches the chain.
+func evaluatePins(subject string, matches []PinMatch) []Finding {
+	for _, m := range matches {
+		if m.Matched {
+			return nil
+		}
+	}
+	return []Finding{{
+		Status:  StatusCritical,
+		Message: fmt.Sprintf("none of the %d pins match the chain of %s", len(matches), subject),
+	}}
+}
@@ -0,0 +1,171 @@
+package cert_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sensu/cert-checks/internal/cert"
+	"github.com/sensu/cert-checks/internal/cert/testcert"
+)
+
+func TestParsePin(t *testing.T) {
+	digest := sha256.Sum256([]byte("sensu"))
+	b64 := base64.StdEncoding.EncodeToString(digest[:])
+	hexDigest := hex.EncodeToString(digest[:])
+	var colons []string
+	for i := 0; i < len(hexDigest); i += 2 {
+		colons = append(colons, strings.ToUpper(hexDigest[i:i+2]))
+	}
+
+	testCases := []struct {
+		Name      string
+		Kind      string
+		Value     string
+		Expected  string
+		ExpectErr bool
+	}{
+		{Name: "base64", Kind: cert.PinSPKI, Value: b64, Expected: "sha256/" + b64},
+		{Name: "prefixed base64", Kind: cert.PinSPKI, Value: "sha256/" + b64, Expected: "sha256/" + b64},
+		{Name: "hex", Kind: cert.PinCertificate, Value: hexDigest, Expected: hexDigest},
+		{Name: "colon separated hex", Kind: cert.PinCertificate, Value: strings.Join(colons, ":"), Expected: hexDigest},
+		{Name: "base64 certificate pin", Kind: cert.PinCertificate, Value: b64, Expected: hexDigest},
+		{Name: "short digest", Kind: cert.PinSPKI, Value: hexDigest[:40], ExpectErr: true},
+		{Name: "not encoded", Kind: cert.PinSPKI, Value: "sensu", ExpectErr: true},
+		{Name: "unknown kind", Kind: "sha1", Value: b64, ExpectErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			pin, err := cert.ParsePin(tc.Kind, tc.Value)
+			if err != nil && !tc.ExpectErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if err == nil && tc.ExpectErr {
+				t.Fatalf("expected error parsing %q", tc.Value)
+			}
+			if err == nil && pin.String() != tc.Expected {
+				t.Errorf("expected %s. actual: %s", tc.Expected, pin.String())
+			}
+		})
+	}
+}
+
+func TestCollectMetricsPins(t *testing.T) {
+	ctx := context.Background()
+
+	issuedAt := time.Now().Add(-time.Hour)
+	duration := time.Hour * 72
+	root, _, err := testcert.New("root.sensu.io", issuedAt, duration)
+	if err != nil {
+		t.Fatalf("could not create root certificate: %v", err)
+	}
+	leaf, chainBytes, err := testcert.NewIssued("pinned.sensu.io", issuedAt, duration, root)
+	if err != nil {
+		t.Fatalf("could not create leaf certificate: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "chain.pem")
+	if err := os.WriteFile(path, chainBytes, 0644); err != nil {
+		t.Fatalf("could not write certificate chain: %v", err)
+	}
+	leafCert, err := x509.ParseCertificate(leaf.Certificate[0])
+	if err != nil {
+		t.Fatalf("could not parse leaf certificate: %v", err)
+	}
+	rootCert, err := x509.ParseCertificate(root.Certificate[0])
+	if err != nil {
+		t.Fatalf("could not parse root certificate: %v", err)
+	}
+	spki := func(c *x509.Certificate) cert.Pin {
+		digest := sha256.Sum256(c.RawSubjectPublicKeyInfo)
+		return cert.Pin{Kind: cert.PinSPKI, Digest: digest[:]}
+	}
+	fingerprint := func(c *x509.Certificate) cert.Pin {
+		digest := sha256.Sum256(c.Raw)
+		return cert.Pin{Kind: cert.PinCertificate, Digest: digest[:]}
+	}
+	// testcert.New reuses its key, so the other certificate needs its own
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate key: %v", err)
+	}
+	other, _, err := testcert.NewWithKey("other.sensu.io", issuedAt, duration, key)
+	if err != nil {
+		t.Fatalf("could not create certificate: %v", err)
+	}
+	otherCert, err := x509.ParseCertificate(other.Certificate[0])
+	if err != nil {
+		t.Fatalf("could not parse certificate: %v", err)
+	}
+
+	testCases := []struct {
+		Name           string
+		Pins           []cert.Pin
+		ExpectedStatus cert.Status
+		Expected       []string
+	}{
+		{
+			Name:           "leaf public key",
+			Pins:           []cert.Pin{spki(leafCert)},
+			ExpectedStatus: cert.StatusOK,
+			Expected:       []string{"pinned.sensu.io"},
+		}, {
+			Name:           "root fingerprint with backup pin",
+			Pins:           []cert.Pin{fingerprint(otherCert), fingerprint(rootCert)},
+			ExpectedStatus: cert.StatusOK,
+			Expected:       []string{"", "root.sensu.io"},
+		}, {
+			Name:           "fingerprint of public key is not a certificate pin",
+			Pins:           []cert.Pin{{Kind: cert.PinCertificate, Digest: spki(leafCert).Digest}},
+			ExpectedStatus: cert.StatusCritical,
+			Expected:       []string{""},
+		}, {
+			Name:           "no pin matches",
+			Pins:           []cert.Pin{spki(otherCert), fingerprint(otherCert)},
+			ExpectedStatus: cert.StatusCritical,
+			Expected:       []string{"", ""},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			actual, err := collectSingle(t, ctx, "file://"+path, cert.Config{Pins: tc.Pins})
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if status := actual.Status(); status != tc.ExpectedStatus {
+				t.Errorf("expected status %v. actual: %v (%v)", tc.ExpectedStatus, status, actual.Findings)
+			}
+			if len(actual.Pins) != len(tc.Expected) {
+				t.Fatalf("expected %d pins. actual: %v", len(tc.Expected), actual.Pins)
+			}
+			for i, m := range actual.Pins {
+				if m.Matched != (tc.Expected[i] != "") || m.Subject != tc.Expected[i] {
+					t.Errorf("expected pin %d to match %q. actual: %v", i, tc.Expected[i], m)
+				}
+			}
+			output := cert.Output(actual)
+			for _, m := range actual.Pins {
+				if !strings.Contains(output, `pin="`+m.Pin.String()+`"`) {
+					t.Errorf("expected pin %s in output:\n%s", m.Pin, output)
+				}
+			}
+		})
+	}
+
+	actual, err := collectSingle(t, ctx, "file://"+path, cert.Config{})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if actual.Pins != nil {
+		t.Errorf("expected no pins by default. actual: %v", actual.Pins)
+	}
+}
@@ -0,0 +1,30 @@
+package cert
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// decodePKCS12 returns the chain of the private key in a PKCS#12 keystore,
+// leaf first. Keystores without a private key are decoded as trust stores,
+// split into chains. Errors never include the password.
+func decodePKCS12(data []byte, password string) (*loadResult, error) {
+	_, leaf, caCerts, err := pkcs12.DecodeChain(data, password)
+	if err == nil {
+		return &loadResult{entries: []entry{{chain: append([]*x509.Certificate{leaf}, caCerts...)}}}, nil
+	}
+	if errors.Is(err, pkcs12.ErrIncorrectPassword) {
+		return nil, fmt.Errorf("error decoding PKCS#12 keystore: incorrect password")
+	}
+	certs, trustErr := pkcs12.DecodeTrustStore(data, password)
+	if trustErr != nil {
+		return nil, fmt.Errorf("error decoding PKCS#12 keystore: %v", err)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("error decoding PKCS#12 keystore: no certificates found")
+	}
+	return &loadResult{entries: chainEntries(certs, nil)}, nil
+}
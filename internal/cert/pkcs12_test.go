@@ -0,0 +1,142 @@
+package cert_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sensu/cert-checks/internal/cert"
+	"github.com/sensu/cert-checks/internal/cert/testcert"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+func TestCollectMetricsFromPKCS12(t *testing.T) {
+	ctx := context.Background()
+
+	issuedAt := time.Unix(1<<30, 0)
+	duration := time.Hour * 72
+	root, _, err := testcert.New("root.sensu.io", issuedAt, duration)
+	if err != nil {
+		t.Fatalf("could not create root certificate: %v", err)
+	}
+	leaf, _, err := testcert.NewIssued("imposter.sensu.io", issuedAt, duration, root)
+	if err != nil {
+		t.Fatalf("could not create leaf certificate: %v", err)
+	}
+	leafCert, err := x509.ParseCertificate(leaf.Certificate[0])
+	if err != nil {
+		t.Fatalf("could not parse leaf certificate: %v", err)
+	}
+	rootCert, err := x509.ParseCertificate(root.Certificate[0])
+	if err != nil {
+		t.Fatalf("could not parse root certificate: %v", err)
+	}
+
+	const password = "s3cr3t-p4ssw0rd"
+	keystore, err := pkcs12.Encode(rand.Reader, leaf.PrivateKey, leafCert, []*x509.Certificate{rootCert}, password)
+	if err != nil {
+		t.Fatalf("could not encode keystore: %v", err)
+	}
+	truststore, err := pkcs12.EncodeTrustStore(rand.Reader, []*x509.Certificate{rootCert, leafCert}, password)
+	if err != nil {
+		t.Fatalf("could not encode trust store: %v", err)
+	}
+
+	tmpDir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatalf("could not write %s: %v", name, err)
+		}
+		return path
+	}
+	keystorePath := write("keystore.p12", keystore)
+	keystoreNoExtPath := write("keystore.bin", keystore)
+	truststorePath := write("truststore.pfx", truststore)
+
+	testCases := []struct {
+		Name      string
+		Cert      string
+		Format    string
+		Password  string
+		Subjects  []string
+		ExpectErr bool
+	}{
+		{
+			Name:     "pkcs12 scheme",
+			Cert:     "pkcs12://" + keystoreNoExtPath,
+			Password: password,
+			Subjects: []string{"imposter.sensu.io", "root.sensu.io"},
+		}, {
+			Name:     "detected by extension",
+			Cert:     "file://" + keystorePath,
+			Password: password,
+			Subjects: []string{"imposter.sensu.io", "root.sensu.io"},
+		}, {
+			Name:     "explicit format",
+			Cert:     "file://" + keystoreNoExtPath,
+			Format:   cert.FormatPKCS12,
+			Password: password,
+			Subjects: []string{"imposter.sensu.io", "root.sensu.io"},
+		}, {
+			Name:     "trust store",
+			Cert:     "file://" + truststorePath,
+			Password: password,
+			Subjects: []string{"root.sensu.io", "imposter.sensu.io"},
+		}, {
+			Name:      "incorrect password",
+			Cert:      "pkcs12://" + keystorePath,
+			Password:  "not-" + password,
+			ExpectErr: true,
+		}, {
+			Name:      "trust store incorrect password",
+			Cert:      "pkcs12://" + truststorePath,
+			Password:  "not-" + password,
+			ExpectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			results, err := cert.CollectMetrics(ctx, tc.Cert, cert.Config{
+				Now:      func() time.Time { return issuedAt },
+				Format:   tc.Format,
+				Password: tc.Password,
+			})
+			if err != nil && !tc.ExpectErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if err != nil {
+				if strings.Contains(err.Error(), tc.Password) {
+					t.Errorf("error must not contain the password: %v", err)
+				}
+				return
+			}
+			if tc.ExpectErr {
+				t.Fatal("expected error")
+			}
+			var chain []cert.CertificateMetrics
+			for _, m := range results {
+				chain = append(chain, m.Chain...)
+			}
+			if len(chain) != len(tc.Subjects) {
+				t.Fatalf("expected %d certificates. actual: %d", len(tc.Subjects), len(chain))
+			}
+			for i, subject := range tc.Subjects {
+				if chain[i].Tags["subject"] != subject {
+					t.Errorf("expected certificate %d subject %s. actual: %s", i, subject, chain[i].Tags["subject"])
+				}
+			}
+			for _, m := range results {
+				if strings.Contains(m.Output(), tc.Password) {
+					t.Error("output must not contain the password")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,346 @@
+package cert
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+var (
+	oidSCTList     = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+	oidOCSPSCTList = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 5}
+)
+
+// Sources of signed certificate timestamps.
+const (
+	SCTSourceCertificate = "certificate"
+	SCTSourceTLS         = "tls"
+	SCTSourceOCSP        = "ocsp"
+)
+
+var errSCTTruncated = errors.New("truncated data")
+
+// Transparency describes the certificate transparency evidence for the leaf.
+type Transparency struct {
+	SCTs []SCT
+	// Logs is the number of distinct logs with an SCT, counting only valid
+	// SCTs when they are verified
+	Logs int
+}
+
+// SCT is a signed certificate timestamp from a certificate transparency log.
+type SCT struct {
+	// LogID is the base64 encoded ID of the log
+	LogID string
+	// Source is where the SCT was delivered: certificate, tls or ocsp
+	Source    string
+	Timestamp time.Time
+	// Log describes the log, when it is in the log list
+	Log string
+	// Valid is set when the signature was verified, nil when SCTs are not
+	// verified
+	Valid *bool
+
+	version    byte
+	logID      []byte
+	timestamp  uint64
+	extensions []byte
+	hashAlg    byte
+	sigAlg     byte
+	signature  []byte
+}
+
+// ctLog is a log of a CT log list, in the v2 or v3 log list format.
+type ctLog struct {
+	Description string `json:"description"`
+	LogID       string `json:"log_id"`
+	Key         string `json:"key"`
+}
+
+type ctLogList struct {
+	Logs      []ctLog `json:"logs"`
+	Operators []struct {
+		Logs []ctLog `json:"logs"`
+	} `json:"operators"`
+}
+
+// ctLogKey is the public key of a log, indexed by log ID.
+type ctLogKey struct {
+	description string
+	key         crypto.PublicKey
+}
+
+// loadCTLogs reads a CT log list JSON file.
+func loadCTLogs(path string) (map[string]ctLogKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading CT log list: %v", err)
+	}
+	var list ctLogList
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("error decoding CT log list: %v", err)
+	}
+	logs := list.Logs
+	for _, op := range list.Operators {
+		logs = append(logs, op.Logs...)
+	}
+	keys := make(map[string]ctLogKey, len(logs))
+	for _, l := range logs {
+		der, err := base64.StdEncoding.DecodeString(l.Key)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding key of CT log %s: %v", l.Description, err)
+		}
+		key, err := x509.ParsePKIXPublicKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing key of CT log %s: %v", l.Description, err)
+		}
+		id := l.LogID
+		if id == "" {
+			sum := sha256.Sum256(der)
+			id = base64.StdEncoding.EncodeToString(sum[:])
+		}
+		keys[id] = ctLogKey{description: l.Description, key: key}
+	}
+	return keys, nil
+}
+
+// collectSCTs from the leaf certificate extension, the TLS extension and the
+// stapled OCSP response. SCTs are verified when logs is not nil.
+func collectSCTs(chain []*x509.Certificate, tlsSCTs [][]byte, staple []byte, logs map[string]ctLogKey) (*Transparency, []Finding) {
+	leaf := chain[0]
+	var scts []SCT
+	var findings []Finding
+	addList := func(source string, ext []byte) {
+		var list []byte
+		if _, err := asn1.Unmarshal(ext, &list); err != nil {
+			findings = append(findings, Finding{Status: StatusWarning, Message: fmt.Sprintf("invalid %s SCT list: %v", source, err)})
+			return
+		}
+		r := &sctReader{data: list}
+		r.data = r.vector16()
+		for len(r.data) > 0 && r.err == nil {
+			scts = appendSCT(scts, source, r.vector16())
+		}
+		if r.err != nil {
+			findings = append(findings, Finding{Status: StatusWarning, Message: fmt.Sprintf("invalid %s SCT list: %v", source, r.err)})
+		}
+	}
+	for _, ext := range leaf.Extensions {
+		if ext.Id.Equal(oidSCTList) {
+			addList(SCTSourceCertificate, ext.Value)
+		}
+	}
+	for _, raw := range tlsSCTs {
+		scts = appendSCT(scts, SCTSourceTLS, raw)
+	}
+	if len(staple) > 0 {
+		// the staple signature is checked separately
+		if resp, err := ocsp.ParseResponseForCert(staple, leaf, nil); err == nil {
+			for _, ext := range resp.Extensions {
+				if ext.Id.Equal(oidOCSPSCTList) {
+					addList(SCTSourceOCSP, ext.Value)
+				}
+			}
+		}
+	}
+
+	var issuer *x509.Certificate
+	if logs != nil {
+		issuer, _ = findIssuer(chain)
+	}
+	distinct := map[string]bool{}
+	for i := range scts {
+		s := &scts[i]
+		if s.version != 0 {
+			findings = append(findings, Finding{Status: StatusWarning, Message: fmt.Sprintf("unsupported SCT version %d from log %s", s.version, s.LogID)})
+			continue
+		}
+		if logs == nil {
+			distinct[s.LogID] = true
+			continue
+		}
+		valid := false
+		if log, ok := logs[s.LogID]; ok {
+			s.Log = log.description
+			if err := s.verify(leaf, issuer, log.key); err != nil {
+				findings = append(findings, Finding{
+					Status:  StatusWarning,
+					Message: fmt.Sprintf("SCT from log %s is invalid: %v", log.description, err),
+				})
+			} else {
+				valid = true
+				distinct[s.LogID] = true
+			}
+		}
+		s.Valid = &valid
+	}
+	sort.SliceStable(scts, func(i, j int) bool { return scts[i].Source < scts[j].Source })
+	return &Transparency{SCTs: scts, Logs: len(distinct)}, findings
+}
+
+// appendSCT parses a serialized SCT, skipping malformed ones.
+func appendSCT(scts []SCT, source string, raw []byte) []SCT {
+	r := &sctReader{data: raw}
+	s := SCT{Source: source}
+	if v := r.next(1); len(v) == 1 {
+		s.version = v[0]
+	}
+	s.logID = r.next(32)
+	s.timestamp = r.uint64()
+	s.extensions = r.vector16()
+	if alg := r.next(2); len(alg) == 2 {
+		s.hashAlg, s.sigAlg = alg[0], alg[1]
+	}
+	s.signature = r.vector16()
+	if r.err != nil {
+		return scts
+	}
+	s.LogID = base64.StdEncoding.EncodeToString(s.logID)
+	s.Timestamp = time.Unix(0, int64(s.timestamp)*int64(time.Millisecond)).UTC()
+	return append(scts, s)
+}
+
+// TLS hash and signature algorithms used by CT logs.
+const (
+	tlsHashSHA256     = 4
+	tlsSignatureRSA   = 1
+	tlsSignatureECDSA = 3
+)
+
+// verify the SCT signature over the leaf, or over the precertificate when the
+// SCT is embedded in the leaf.
+func (s *SCT) verify(leaf, issuer *x509.Certificate, key crypto.PublicKey) error {
+	if s.hashAlg != tlsHashSHA256 {
+		return fmt.Errorf("unsupported hash algorithm %d", s.hashAlg)
+	}
+	// version, certificate_timestamp signature type and timestamp
+	signed := make([]byte, 10, 10+len(leaf.Raw))
+	signed[0] = s.version
+	binary.BigEndian.PutUint64(signed[2:], s.timestamp)
+	if s.Source == SCTSourceCertificate {
+		if issuer == nil {
+			return fmt.Errorf("issuer not found in chain")
+		}
+		tbs, err := precertTBS(leaf)
+		if err != nil {
+			return err
+		}
+		issuerKeyHash := sha256.Sum256(issuer.RawSubjectPublicKeyInfo)
+		signed = append(signed, 0, 1)
+		signed = append(signed, issuerKeyHash[:]...)
+		signed = appendUint24Vector(signed, tbs)
+	} else {
+		signed = append(signed, 0, 0)
+		signed = appendUint24Vector(signed, leaf.Raw)
+	}
+	signed = append(signed, byte(len(s.extensions)>>8), byte(len(s.extensions)))
+	signed = append(signed, s.extensions...)
+	digest := sha256.Sum256(signed)
+
+	switch pub := key.(type) {
+	case *ecdsa.PublicKey:
+		if s.sigAlg != tlsSignatureECDSA || !ecdsa.VerifyASN1(pub, digest[:], s.signature) {
+			return fmt.Errorf("signature verification failed")
+		}
+	case *rsa.PublicKey:
+		if s.sigAlg != tlsSignatureRSA {
+			return fmt.Errorf("signature verification failed")
+		}
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], s.signature); err != nil {
+			return fmt.Errorf("signature verification failed")
+		}
+	default:
+		return fmt.Errorf("unsupported log key type %T", key)
+	}
+	return nil
+}
+
+func appendUint24Vector(b, data []byte) []byte {
+	b = append(b, byte(len(data)>>16), byte(len(data)>>8), byte(len(data)))
+	return append(b, data...)
+}
+
+// tbsCertificate is a TBSCertificate whose fields are kept raw, except for
+// the extensions.
+type tbsCertificate struct {
+	Raw                asn1.RawContent
+	Version            int `asn1:"optional,explicit,default:0,tag:0"`
+	SerialNumber       *big.Int
+	SignatureAlgorithm asn1.RawValue
+	Issuer             asn1.RawValue
+	Validity           asn1.RawValue
+	Subject            asn1.RawValue
+	PublicKey          asn1.RawValue
+	UniqueID           asn1.BitString   `asn1:"optional,tag:1"`
+	SubjectUniqueID    asn1.BitString   `asn1:"optional,tag:2"`
+	Extensions         []pkix.Extension `asn1:"optional,explicit,tag:3"`
+}
+
+// precertTBS rebuilds the TBSCertificate the log signed for an embedded SCT,
+// which is the leaf's without the SCT list extension.
+func precertTBS(leaf *x509.Certificate) ([]byte, error) {
+	var tbs tbsCertificate
+	if _, err := asn1.Unmarshal(leaf.RawTBSCertificate, &tbs); err != nil {
+		return nil, fmt.Errorf("error parsing TBS certificate: %v", err)
+	}
+	extensions := tbs.Extensions[:0]
+	for _, ext := range tbs.Extensions {
+		if !ext.Id.Equal(oidSCTList) {
+			extensions = append(extensions, ext)
+		}
+	}
+	tbs.Extensions = extensions
+	tbs.Raw = nil
+	return asn1.Marshal(tbs)
+}
+
+// sctReader reads TLS encoded SCT fields, remembering the first error.
+type sctReader struct {
+	data []byte
+	err  error
+}
+
+func (r *sctReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.data) {
+		r.err = errSCTTruncated
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *sctReader) uint64() uint64 {
+	b := r.next(8)
+	if len(b) < 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+// vector16 reads data prefixed by a 16 bit length.
+func (r *sctReader) vector16() []byte {
+	b := r.next(2)
+	if len(b) < 2 {
+		return nil
+	}
+	return r.next(int(binary.BigEndian.Uint16(b)))
+}
@@ -0,0 +1,280 @@
+package cert_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/sensu/cert-checks/internal/cert"
+	"github.com/sensu/cert-checks/internal/cert/testcert"
+)
+
+var oidSCTList = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+// ctTestLog signs SCTs like a certificate transparency log.
+type ctTestLog struct {
+	key *ecdsa.PrivateKey
+	der []byte
+	id  [32]byte
+}
+
+func newCTTestLog(t *testing.T) *ctTestLog {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate log key: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatalf("could not marshal log key: %v", err)
+	}
+	return &ctTestLog{key: key, der: der, id: sha256.Sum256(der)}
+}
+
+// sct signs an X.509 entry, or a precertificate entry when issuer is set.
+func (l *ctTestLog) sct(t *testing.T, der []byte, issuer *x509.Certificate) []byte {
+	uint24 := func(b []byte) []byte {
+		return append([]byte{byte(len(b) >> 16), byte(len(b) >> 8), byte(len(b))}, b...)
+	}
+	timestamp := make([]byte, 8)
+	binary.BigEndian.PutUint64(timestamp, uint64(time.Unix(1<<30, 0).UnixNano()/int64(time.Millisecond)))
+
+	signed := append([]byte{0, 0}, timestamp...)
+	if issuer != nil {
+		issuerKeyHash := sha256.Sum256(issuer.RawSubjectPublicKeyInfo)
+		signed = append(append(signed, 0, 1), issuerKeyHash[:]...)
+	} else {
+		signed = append(signed, 0, 0)
+	}
+	signed = append(append(signed, uint24(der)...), 0, 0)
+	digest := sha256.Sum256(signed)
+	sig, err := ecdsa.SignASN1(rand.Reader, l.key, digest[:])
+	if err != nil {
+		t.Fatalf("could not sign SCT: %v", err)
+	}
+
+	sct := append([]byte{0}, l.id[:]...)
+	sct = append(sct, timestamp...)
+	sct = append(sct, 0, 0, 4, 3, byte(len(sig)>>8), byte(len(sig)))
+	return append(sct, sig...)
+}
+
+// sctListExtension encodes SCTs as the value of an SCT list extension.
+func sctListExtension(t *testing.T, scts ...[]byte) []byte {
+	var list []byte
+	for _, sct := range scts {
+		list = append(list, byte(len(sct)>>8), byte(len(sct)))
+		list = append(list, sct...)
+	}
+	value, err := asn1.Marshal(append([]byte{byte(len(list) >> 8), byte(len(list))}, list...))
+	if err != nil {
+		t.Fatalf("could not marshal SCT list: %v", err)
+	}
+	return value
+}
+
+func TestCollectMetricsSCT(t *testing.T) {
+	ctx := context.Background()
+
+	issuedAt := time.Now().Add(-time.Hour)
+	duration := time.Hour * 72
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate CA key: %v", err)
+	}
+	ca, caBytes, err := testcert.NewWithKey("ca.sensu.io", issuedAt, duration, caKey)
+	if err != nil {
+		t.Fatalf("could not create CA certificate: %v", err)
+	}
+	caCert, err := x509.ParseCertificate(ca.Certificate[0])
+	if err != nil {
+		t.Fatalf("could not parse CA certificate: %v", err)
+	}
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate leaf key: %v", err)
+	}
+	logA, logB := newCTTestLog(t), newCTTestLog(t)
+
+	// the precertificate is the leaf without the SCT list extension
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "ct.sensu.io"},
+		DNSNames:     []string{"ct.sensu.io"},
+		NotBefore:    issuedAt,
+		NotAfter:     issuedAt.Add(duration),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	precert, err := x509.CreateCertificate(rand.Reader, template, caCert, leafKey.Public(), caKey)
+	if err != nil {
+		t.Fatalf("could not create precertificate: %v", err)
+	}
+	precertTBS, err := x509.ParseCertificate(precert)
+	if err != nil {
+		t.Fatalf("could not parse precertificate: %v", err)
+	}
+	template.ExtraExtensions = []pkix.Extension{{
+		Id:    oidSCTList,
+		Value: sctListExtension(t, logA.sct(t, precertTBS.RawTBSCertificate, caCert)),
+	}}
+	leafDER, err := x509.CreateCertificate(rand.Reader, template, caCert, leafKey.Public(), caKey)
+	if err != nil {
+		t.Fatalf("could not create leaf certificate: %v", err)
+	}
+	staple, err := ocsp.CreateResponse(caCert, caCert, ocsp.Response{
+		Status:       ocsp.Good,
+		SerialNumber: template.SerialNumber,
+		ThisUpdate:   issuedAt,
+		NextUpdate:   issuedAt.Add(time.Hour * 24),
+		ExtraExtensions: []pkix.Extension{{
+			Id:    asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 5},
+			Value: sctListExtension(t, logB.sct(t, leafDER, nil)),
+		}},
+	}, caKey)
+	if err != nil {
+		t.Fatalf("could not create OCSP response: %v", err)
+	}
+
+	serve := func(tlsSCT []byte) string {
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+		srv.TLS = &tls.Config{Certificates: []tls.Certificate{{
+			Certificate:                 [][]byte{leafDER, ca.Certificate[0]},
+			PrivateKey:                  leafKey,
+			SignedCertificateTimestamps: [][]byte{tlsSCT},
+			OCSPStaple:                  staple,
+		}}}
+		srv.StartTLS()
+		t.Cleanup(srv.Close)
+		return "tcp://" + srv.Listener.Addr().String()
+	}
+	tlsSCT := logB.sct(t, leafDER, nil)
+	target := serve(tlsSCT)
+	tampered := append([]byte{}, tlsSCT...)
+	tampered[len(tampered)-1] ^= 0xff
+	tamperedTarget := serve(tampered)
+
+	dir := t.TempDir()
+	leafPath := filepath.Join(dir, "leaf.pem")
+	if err := os.WriteFile(leafPath, append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafDER}), caBytes...), 0644); err != nil {
+		t.Fatalf("could not write certificate: %v", err)
+	}
+	writeLogList := func(name string, logs ...*ctTestLog) string {
+		encode := base64.StdEncoding.EncodeToString
+		// log A in the v3 format with a log ID, log B in the v2 format
+		list := `{"operators": [{"name": "Sensu", "logs": [`
+		if len(logs) > 0 {
+			list += fmt.Sprintf(`{"description": "Sensu Log A", "log_id": %q, "key": %q}`, encode(logs[0].id[:]), encode(logs[0].der))
+		}
+		list += `]}], "logs": [`
+		if len(logs) > 1 {
+			list += fmt.Sprintf(`{"description": "Sensu Log B", "key": %q}`, encode(logs[1].der))
+		}
+		list += `]}`
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(list), 0644); err != nil {
+			t.Fatalf("could not write log list: %v", err)
+		}
+		return path
+	}
+	bothLogs := writeLogList("both.json", logA, logB)
+	onlyLogA := writeLogList("a.json", logA)
+
+	testCases := []struct {
+		Name           string
+		Target         string
+		LogList        string
+		MinSCTs        int
+		ExpectedSCTs   int
+		ExpectedLogs   int
+		ExpectedStatus cert.Status
+	}{
+		{
+			Name:           "certificate, tls and ocsp",
+			Target:         target,
+			MinSCTs:        2,
+			ExpectedSCTs:   3,
+			ExpectedLogs:   2,
+			ExpectedStatus: cert.StatusOK,
+		}, {
+			Name:           "too few logs",
+			Target:         target,
+			MinSCTs:        3,
+			ExpectedSCTs:   3,
+			ExpectedLogs:   2,
+			ExpectedStatus: cert.StatusCritical,
+		}, {
+			Name:           "verified",
+			Target:         target,
+			LogList:        bothLogs,
+			MinSCTs:        2,
+			ExpectedSCTs:   3,
+			ExpectedLogs:   2,
+			ExpectedStatus: cert.StatusOK,
+		}, {
+			Name:           "unknown log",
+			Target:         target,
+			LogList:        onlyLogA,
+			MinSCTs:        2,
+			ExpectedSCTs:   3,
+			ExpectedLogs:   1,
+			ExpectedStatus: cert.StatusCritical,
+		}, {
+			Name:           "invalid signature",
+			Target:         tamperedTarget,
+			LogList:        bothLogs,
+			ExpectedSCTs:   3,
+			ExpectedLogs:   2,
+			ExpectedStatus: cert.StatusWarning,
+		}, {
+			Name:           "embedded in file",
+			Target:         "file://" + leafPath,
+			LogList:        bothLogs,
+			MinSCTs:        1,
+			ExpectedSCTs:   1,
+			ExpectedLogs:   1,
+			ExpectedStatus: cert.StatusOK,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			actual, err := collectSingle(t, ctx, tc.Target, cert.Config{
+				SCT:       true,
+				CTLogList: tc.LogList,
+				MinSCTs:   tc.MinSCTs,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if actual.Transparency == nil {
+				t.Fatal("expected Transparency")
+			}
+			if len(actual.Transparency.SCTs) != tc.ExpectedSCTs {
+				t.Errorf("expected %d SCTs. actual: %v", tc.ExpectedSCTs, actual.Transparency.SCTs)
+			}
+			if actual.Transparency.Logs != tc.ExpectedLogs {
+				t.Errorf("expected %d logs. actual: %d", tc.ExpectedLogs, actual.Transparency.Logs)
+			}
+			if status := actual.Status(); status != tc.ExpectedStatus {
+				t.Errorf("expected status %v. actual: %v (%v)", tc.ExpectedStatus, status, actual.Findings)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package cert
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v2"
+)
+
+// secretKeys holding certificates in Kubernetes TLS secrets, leaf first.
+var secretKeys = []string{"tls.crt", "ca.crt"}
+
+// secretManifest is the subset of a Kubernetes Secret, or a List of objects,
+// needed to find certificates.
+type secretManifest struct {
+	Kind     string `yaml:"kind"`
+	Metadata struct {
+		Name      string `yaml:"name"`
+		Namespace string `yaml:"namespace"`
+	} `yaml:"metadata"`
+	Data       map[string]string `yaml:"data"`
+	StringData map[string]string `yaml:"stringData"`
+	Items      []secretManifest  `yaml:"items"`
+}
+
+// decodeSecrets finds the certificates of every Secret in a YAML or JSON
+// manifest, which may hold several documents or List objects. Each data key
+// holds an entry, or one for every chain of a CA bundle, tagged with the
+// namespace and name of its secret and the data key.
+func decodeSecrets(data []byte) (*loadResult, error) {
+	result := &loadResult{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var manifest secretManifest
+		err := decoder.Decode(&manifest)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error decoding Kubernetes manifest: %v", err)
+		}
+		if err := result.addSecret(manifest); err != nil {
+			return nil, err
+		}
+	}
+	if len(result.entries) == 0 {
+		return nil, fmt.Errorf("%w in Kubernetes secrets", errNoCertificates)
+	}
+	return result, nil
+}
+
+func (l *loadResult) addSecret(manifest secretManifest) error {
+	switch manifest.Kind {
+	case "List", "SecretList":
+		for _, item := range manifest.Items {
+			if err := l.addSecret(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "Secret":
+	default:
+		return nil
+	}
+	for _, key := range secretKeys {
+		// stringData takes precedence as it does when applied
+		pemData := []byte(manifest.StringData[key])
+		if len(pemData) == 0 {
+			encoded, ok := manifest.Data[key]
+			if !ok {
+				continue
+			}
+			var err error
+			if pemData, err = base64.StdEncoding.DecodeString(encoded); err != nil {
+				return fmt.Errorf("error decoding %s of secret %s: %v", key, manifest.Metadata.Name, err)
+			}
+		}
+		chain, err := decodePEM(pemData)
+		if err != nil {
+			return fmt.Errorf("error decoding %s of secret %s: %v", key, manifest.Metadata.Name, err)
+		}
+		tags := map[string]string{"secret": manifest.Metadata.Name, "key": key}
+		if manifest.Metadata.Namespace != "" {
+			tags["namespace"] = manifest.Metadata.Namespace
+		}
+		l.entries = append(l.entries, chainEntries(chain, tags)...)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package cert_test
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sensu/cert-checks/internal/cert"
+	"github.com/sensu/cert-checks/internal/cert/testcert"
+)
+
+func TestCollectMetricsFromSecret(t *testing.T) {
+	ctx := context.Background()
+
+	issuedAt := time.Unix(1<<30, 0)
+	duration := time.Hour * 72
+	root, rootBytes, err := testcert.New("root.sensu.io", issuedAt, duration)
+	if err != nil {
+		t.Fatalf("could not create root certificate: %v", err)
+	}
+	_, chainBytes, err := testcert.NewIssued("web.sensu.io", issuedAt, duration, root)
+	if err != nil {
+		t.Fatalf("could not create leaf certificate: %v", err)
+	}
+	_, apiBytes, err := testcert.New("api.sensu.io", issuedAt, duration)
+	if err != nil {
+		t.Fatalf("could not create certificate: %v", err)
+	}
+	leafBytes := chainBytes[:len(chainBytes)-len(rootBytes)]
+	encode := func(b []byte) string { return base64.StdEncoding.EncodeToString(b) }
+	indent := func(b []byte) string { return strings.ReplaceAll(strings.TrimSpace(string(b)), "\n", "\n      ") }
+
+	yamlManifest := fmt.Sprintf(`apiVersion: v1
+kind: Secret
+type: kubernetes.io/tls
+metadata:
+  name: web-tls
+  namespace: web
+data:
+  tls.crt: %s
+  tls.key: %s
+  ca.crt: %s
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: unrelated
+data:
+  key: value
+---
+apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: Secret
+  metadata:
+    name: api-tls
+  stringData:
+    tls.crt: |
+      %s
+`, encode(leafBytes), encode(testcert.SigningKey), encode(rootBytes), indent(apiBytes))
+	jsonManifest := fmt.Sprintf(`{"apiVersion": "v1", "kind": "Secret", "metadata": {"name": "web-tls", "namespace": "web"}, "data": {"tls.crt": %q}}`, encode(leafBytes))
+
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "secrets.yaml")
+	if err := os.WriteFile(yamlPath, []byte(yamlManifest), 0644); err != nil {
+		t.Fatalf("could not write manifest: %v", err)
+	}
+	jsonPath := filepath.Join(dir, "secret.json")
+	if err := os.WriteFile(jsonPath, []byte(jsonManifest), 0644); err != nil {
+		t.Fatalf("could not write manifest: %v", err)
+	}
+	invalidPath := filepath.Join(dir, "invalid.yaml")
+	if err := os.WriteFile(invalidPath, []byte("kind: Secret\ndata:\n  tls.crt: '!!'\n"), 0644); err != nil {
+		t.Fatalf("could not write manifest: %v", err)
+	}
+
+	type tags = map[string]string
+	testCases := []struct {
+		Name      string
+		Location  string
+		Expected  []tags
+		ExpectErr bool
+	}{
+		{
+			Name:     "multi document yaml",
+			Location: "secret://" + yamlPath,
+			Expected: []tags{
+				{"namespace": "web", "secret": "web-tls", "key": "tls.crt", "subject": "web.sensu.io"},
+				{"namespace": "web", "secret": "web-tls", "key": "ca.crt", "subject": "root.sensu.io"},
+				{"secret": "api-tls", "key": "tls.crt", "subject": "api.sensu.io"},
+			},
+		}, {
+			Name:     "json detected by extension",
+			Location: "file://" + jsonPath,
+			Expected: []tags{
+				{"namespace": "web", "secret": "web-tls", "key": "tls.crt", "subject": "web.sensu.io"},
+			},
+		}, {
+			Name:      "invalid base64",
+			Location:  "secret://" + invalidPath,
+			ExpectErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			results, err := cert.CollectMetrics(ctx, tc.Location, cert.Config{
+				Now: func() time.Time { return issuedAt },
+			})
+			if tc.ExpectErr {
+				if err == nil {
+					t.Error("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			var actualTags []tags
+			for _, m := range results {
+				c := m.Chain[0]
+				actualTags = append(actualTags, tags{})
+				for _, key := range []string{"namespace", "secret", "key", "subject"} {
+					if value, ok := c.Tags[key]; ok {
+						actualTags[len(actualTags)-1][key] = value
+					}
+				}
+			}
+			if !reflect.DeepEqual(actualTags, tc.Expected) {
+				t.Errorf("expected tags %v. actual: %v", tc.Expected, actualTags)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package cert
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+)
+
+type starttlsUpgrade struct {
+	port      int
+	negotiate func(net.Conn) error
+}
+
+// starttlsUpgrades by URL scheme for protocols that upgrade a plaintext
+// connection to TLS.
+var starttlsUpgrades = map[string]starttlsUpgrade{
+	"smtp": {port: 25, negotiate: smtpSTARTTLS},
+	"imap": {port: 143, negotiate: imapSTARTTLS},
+	"pop3": {port: 110, negotiate: pop3STLS},
+	"ftp":  {port: 21, negotiate: ftpAUTHTLS},
+
+	"postgres":   {port: 5432, negotiate: postgresSSLRequest},
+	"postgresql": {port: 5432, negotiate: postgresSSLRequest},
+	"mysql":      {port: 3306, negotiate: mysqlSSLRequest},
+
+	"ldap": {port: 389, negotiate: ldapStartTLS},
+}
+
+// smtpSTARTTLS negotiates TLS as described in RFC 3207.
+func smtpSTARTTLS(conn net.Conn) error {
+	text := textproto.NewConn(conn)
+	if _, _, err := text.ReadResponse(220); err != nil {
+		return fmt.Errorf("smtp greeting: %v", err)
+	}
+	if err := text.PrintfLine("EHLO cert-checks"); err != nil {
+		return err
+	}
+	if _, _, err := text.ReadResponse(250); err != nil {
+		return fmt.Errorf("smtp EHLO: %v", err)
+	}
+	if err := text.PrintfLine("STARTTLS"); err != nil {
+		return err
+	}
+	if _, _, err := text.ReadResponse(220); err != nil {
+		return fmt.Errorf("smtp STARTTLS: %v", err)
+	}
+	return nil
+}
+
+// imapSTARTTLS negotiates TLS as described in RFC 3501.
+func imapSTARTTLS(conn net.Conn) error {
+	text := textproto.NewConn(conn)
+	greeting, err := text.ReadLine()
+	if err != nil {
+		return fmt.Errorf("imap greeting: %v", err)
+	}
+	if !strings.HasPrefix(greeting, "* OK") {
+		return fmt.Errorf("imap greeting: %s", greeting)
+	}
+	if err := text.PrintfLine("a001 STARTTLS"); err != nil {
+		return err
+	}
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return fmt.Errorf("imap STARTTLS: %v", err)
+		}
+		// skip untagged responses
+		if !strings.HasPrefix(line, "a001 ") {
+			continue
+		}
+		if !strings.HasPrefix(line, "a001 OK") {
+			return fmt.Errorf("imap STARTTLS: %s", line)
+		}
+		return nil
+	}
+}
+
+// pop3STLS negotiates TLS as described in RFC 2595.
+func pop3STLS(conn net.Conn) error {
+	text := textproto.NewConn(conn)
+	greeting, err := text.ReadLine()
+	if err != nil {
+		return fmt.Errorf("pop3 greeting: %v", err)
+	}
+	if !strings.HasPrefix(greeting, "+OK") {
+		return fmt.Errorf("pop3 greeting: %s", greeting)
+	}
+	if err := text.PrintfLine("STLS"); err != nil {
+		return err
+	}
+	line, err := text.ReadLine()
+	if err != nil {
+		return fmt.Errorf("pop3 STLS: %v", err)
+	}
+	if !strings.HasPrefix(line, "+OK") {
+		return fmt.Errorf("pop3 STLS: %s", line)
+	}
+	return nil
+}
+
+// ftpAUTHTLS negotiates TLS as described in RFC 4217.
+func ftpAUTHTLS(conn net.Conn) error {
+	text := textproto.NewConn(conn)
+	if _, _, err := text.ReadResponse(220); err != nil {
+		return fmt.Errorf("ftp greeting: %v", err)
+	}
+	if err := text.PrintfLine("AUTH TLS"); err != nil {
+		return err
+	}
+	if _, _, err := text.ReadResponse(234); err != nil {
+		return fmt.Errorf("ftp AUTH TLS: %v", err)
+	}
+	return nil
+}
+
+// postgresSSLRequestCode is the protocol version sent in an SSLRequest message.
+const postgresSSLRequestCode = 80877103
+
+// postgresSSLRequest negotiates TLS by sending the PostgreSQL SSLRequest
+// message and waiting for the server to accept it.
+func postgresSSLRequest(conn net.Conn) error {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint32(msg[0:4], 8)
+	binary.BigEndian.PutUint32(msg[4:8], postgresSSLRequestCode)
+	if _, err := conn.Write(msg); err != nil {
+		return err
+	}
+	resp := make([]byte, 1)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return fmt.Errorf("postgres SSLRequest: %v", err)
+	}
+	if resp[0] != 'S' {
+		return fmt.Errorf("postgres server does not support SSL")
+	}
+	return nil
+}
+
+const (
+	mysqlClientProtocol41       = 0x00000200
+	mysqlClientSSL              = 0x00000800
+	mysqlClientSecureConnection = 0x00008000
+	mysqlMaxPacketSize          = 1<<24 - 1
+	mysqlCharsetUTF8MB4         = 45
+)
+
+// mysqlSSLRequest reads the MySQL initial handshake packet and replies with an
+// SSL request packet when the server supports TLS.
+func mysqlSSLRequest(conn net.Conn) error {
+	seq, payload, err := readMySQLPacket(conn)
+	if err != nil {
+		return fmt.Errorf("mysql handshake: %v", err)
+	}
+	if len(payload) > 0 && payload[0] == 0xff {
+		if len(payload) > 3 {
+			return fmt.Errorf("mysql handshake: server error %d: %s", binary.LittleEndian.Uint16(payload[1:3]), payload[3:])
+		}
+		return fmt.Errorf("mysql handshake: server error")
+	}
+	if len(payload) == 0 || payload[0] != 10 {
+		return fmt.Errorf("mysql handshake: unsupported protocol version")
+	}
+	// protocol version, null terminated server version, connection id,
+	// auth plugin data part 1 and a filler precede the capability flags
+	end := 1
+	for end < len(payload) && payload[end] != 0 {
+		end++
+	}
+	offset := end + 1 + 4 + 8 + 1
+	if len(payload) < offset+2 {
+		return fmt.Errorf("mysql handshake: packet too short")
+	}
+	capabilities := uint32(binary.LittleEndian.Uint16(payload[offset : offset+2]))
+	if capabilities&mysqlClientSSL == 0 {
+		return fmt.Errorf("mysql server does not support SSL")
+	}
+
+	request := make([]byte, 4+32)
+	binary.LittleEndian.PutUint32(request[0:4], 32)
+	request[3] = seq + 1
+	binary.LittleEndian.PutUint32(request[4:8], mysqlClientProtocol41|mysqlClientSSL|mysqlClientSecureConnection)
+	binary.LittleEndian.PutUint32(request[8:12], mysqlMaxPacketSize)
+	request[12] = mysqlCharsetUTF8MB4
+	_, err = conn.Write(request)
+	return err
+}
+
+// readMySQLPacket reads a packet made of a 3 byte little endian payload
+// length, a sequence number and the payload.
+func readMySQLPacket(r io.Reader) (byte, []byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	length := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return header[3], payload, nil
+}
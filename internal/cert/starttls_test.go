@@ -0,0 +1,209 @@
+package cert_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"testing"
+	"time"
+
+	"github.com/sensu/cert-checks/internal/cert"
+	"github.com/sensu/cert-checks/internal/cert/testcert"
+)
+
+// serveSTARTTLS accepts a single connection, runs the plaintext dialog and then
+// completes a TLS handshake with the given certificate.
+func serveSTARTTLS(t *testing.T, keyPair tls.Certificate, dialog func(*textproto.Conn) error) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not start test server: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+		text := textproto.NewConn(conn)
+		if err := dialog(text); err != nil {
+			return
+		}
+		// the client may send its hello without waiting for a response
+		buffered := bufferedConn{Conn: conn, r: text.R}
+		_ = tls.Server(buffered, &tls.Config{Certificates: []tls.Certificate{keyPair}}).Handshake()
+	}()
+	return ln.Addr().String()
+}
+
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// expect reads a line from the client and fails the dialog when it differs.
+func expect(text *textproto.Conn, line string) error {
+	actual, err := text.ReadLine()
+	if err != nil {
+		return err
+	}
+	if actual != line {
+		return fmt.Errorf("unexpected command %q", actual)
+	}
+	return nil
+}
+
+func TestCollectMetricsFromSTARTTLS(t *testing.T) {
+	ctx := context.Background()
+
+	issuedAt := time.Unix(1<<30, 0)
+	duration := time.Hour * 72
+	keyPair, _, err := testcert.New("mail.sensu.io", issuedAt, duration)
+	if err != nil {
+		t.Fatalf("could not load testcert as x509 key pair: %v", err)
+	}
+
+	smtp := func(text *textproto.Conn) error {
+		_ = text.PrintfLine("220 mail.sensu.io ESMTP")
+		if err := expect(text, "EHLO cert-checks"); err != nil {
+			return err
+		}
+		_ = text.PrintfLine("250-mail.sensu.io")
+		_ = text.PrintfLine("250-PIPELINING")
+		_ = text.PrintfLine("250 STARTTLS")
+		if err := expect(text, "STARTTLS"); err != nil {
+			return err
+		}
+		return text.PrintfLine("220 2.0.0 Ready to start TLS")
+	}
+	imap := func(text *textproto.Conn) error {
+		_ = text.PrintfLine("* OK [CAPABILITY IMAP4rev1 STARTTLS] ready")
+		if err := expect(text, "a001 STARTTLS"); err != nil {
+			return err
+		}
+		_ = text.PrintfLine("* CAPABILITY IMAP4rev1 STARTTLS")
+		return text.PrintfLine("a001 OK Begin TLS negotiation now")
+	}
+	pop3 := func(text *textproto.Conn) error {
+		_ = text.PrintfLine("+OK POP3 ready")
+		if err := expect(text, "STLS"); err != nil {
+			return err
+		}
+		return text.PrintfLine("+OK Begin TLS negotiation")
+	}
+	ftp := func(text *textproto.Conn) error {
+		_ = text.PrintfLine("220-Welcome")
+		_ = text.PrintfLine("220 FTP ready")
+		if err := expect(text, "AUTH TLS"); err != nil {
+			return err
+		}
+		return text.PrintfLine("234 AUTH TLS successful")
+	}
+	smtpNoSTARTTLS := func(text *textproto.Conn) error {
+		_ = text.PrintfLine("220 mail.sensu.io ESMTP")
+		if err := expect(text, "EHLO cert-checks"); err != nil {
+			return err
+		}
+		_ = text.PrintfLine("250 mail.sensu.io")
+		if err := expect(text, "STARTTLS"); err != nil {
+			return err
+		}
+		_ = text.PrintfLine("502 5.5.1 Command not implemented")
+		return fmt.Errorf("STARTTLS not supported")
+	}
+
+	postgres := func(accept byte) func(*textproto.Conn) error {
+		return func(text *textproto.Conn) error {
+			msg := make([]byte, 8)
+			if _, err := io.ReadFull(text.R, msg); err != nil {
+				return err
+			}
+			if binary.BigEndian.Uint32(msg[4:8]) != 80877103 {
+				return fmt.Errorf("unexpected message %x", msg)
+			}
+			_ = text.W.WriteByte(accept)
+			_ = text.W.Flush()
+			if accept != 'S' {
+				return fmt.Errorf("SSL not supported")
+			}
+			return nil
+		}
+	}
+	mysql := func(capabilities uint16) func(*textproto.Conn) error {
+		return func(text *textproto.Conn) error {
+			payload := []byte{10}
+			payload = append(payload, "8.0.30\x00"...)
+			payload = append(payload, 1, 0, 0, 0)
+			payload = append(payload, "12345678"...)
+			payload = append(payload, 0, byte(capabilities), byte(capabilities>>8))
+			payload = append(payload, 45, 2, 0)
+			_, _ = text.W.Write([]byte{byte(len(payload)), 0, 0, 0})
+			_, _ = text.W.Write(payload)
+			_ = text.W.Flush()
+			request := make([]byte, 36)
+			if _, err := io.ReadFull(text.R, request); err != nil {
+				return err
+			}
+			if request[3] != 1 || binary.LittleEndian.Uint32(request[4:8])&0x0800 == 0 {
+				return fmt.Errorf("unexpected SSL request %x", request)
+			}
+			return nil
+		}
+	}
+
+	testCases := []struct {
+		Name      string
+		Scheme    string
+		Dialog    func(*textproto.Conn) error
+		ExpectErr bool
+	}{
+		{Name: "smtp", Scheme: "smtp", Dialog: smtp},
+		{Name: "imap", Scheme: "imap", Dialog: imap},
+		{Name: "pop3", Scheme: "pop3", Dialog: pop3},
+		{Name: "ftp", Scheme: "ftp", Dialog: ftp},
+		{Name: "smtp without STARTTLS", Scheme: "smtp", Dialog: smtpNoSTARTTLS, ExpectErr: true},
+		{Name: "imap dialog against smtp server", Scheme: "imap", Dialog: smtp, ExpectErr: true},
+		{Name: "postgres", Scheme: "postgres", Dialog: postgres('S')},
+		{Name: "postgresql", Scheme: "postgresql", Dialog: postgres('S')},
+		{Name: "postgres without SSL", Scheme: "postgres", Dialog: postgres('N'), ExpectErr: true},
+		{Name: "mysql", Scheme: "mysql", Dialog: mysql(0xffff)},
+		{Name: "mysql without SSL", Scheme: "mysql", Dialog: mysql(0xffff &^ 0x0800), ExpectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+			defer cancel()
+			addr := serveSTARTTLS(t, keyPair, tc.Dialog)
+			actual, err := collectSingle(t, ctx, tc.Scheme+"://"+addr, cert.Config{
+				Now: func() time.Time { return issuedAt },
+			})
+			if err != nil && !tc.ExpectErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if err != nil {
+				return
+			}
+			if tc.ExpectErr {
+				t.Fatal("expected error")
+			}
+			if actual.Tags["subject"] != "mail.sensu.io" {
+				t.Errorf("expected subject mail.sensu.io. actual: %s", actual.Tags["subject"])
+			}
+			if actual.SecondsUntilExpires != int(duration.Seconds()) {
+				t.Errorf("expected SecondsUntilExpires to be: %d. actual: %d", int(duration.Seconds()), actual.SecondsUntilExpires)
+			}
+		})
+	}
+}
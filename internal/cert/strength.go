@@ -0,0 +1,79 @@
+package cert
+
+import (
+	"bytes"
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"strings"
+)
+
+// DefaultMinRSABits is the smallest RSA key accepted when no minimum is set.
+const DefaultMinRSABits = 2048
+
+// minCurveBits is the smallest elliptic curve accepted.
+const minCurveBits = 256
+
+// Strength of the key and signature of a certificate.
+type Strength struct {
+	// KeyAlgorithm is RSA, ECDSA, Ed25519 or DSA
+	KeyAlgorithm string
+	KeyBits      int
+	// SignatureAlgorithm the issuer signed the certificate with
+	SignatureAlgorithm string
+	// Weak is set when the key or signature violates the policy
+	Weak bool
+}
+
+// evaluateStrength of a certificate against the crypto policy. The signature
+// of self-signed certificates beyond the leaf is not checked, as the trust
+// in roots does not rest on it.
+func evaluateStrength(c *x509.Certificate, leaf bool, minRSABits int) (*Strength, []Finding) {
+	if minRSABits <= 0 {
+		minRSABits = DefaultMinRSABits
+	}
+	s := &Strength{
+		KeyAlgorithm:       c.PublicKeyAlgorithm.String(),
+		SignatureAlgorithm: c.SignatureAlgorithm.String(),
+	}
+	subject := name(c.Subject)
+	var findings []Finding
+	flag := func(status Status, format string, args ...interface{}) {
+		s.Weak = true
+		findings = append(findings, Finding{
+			Status:  status,
+			Message: fmt.Sprintf("certificate %s %s", subject, fmt.Sprintf(format, args...)),
+		})
+	}
+
+	switch key := c.PublicKey.(type) {
+	case *rsa.PublicKey:
+		s.KeyBits = key.N.BitLen()
+		if s.KeyBits < minRSABits {
+			flag(StatusCritical, "has a %d bit RSA key, at least %d bits required", s.KeyBits, minRSABits)
+		}
+	case *ecdsa.PublicKey:
+		s.KeyBits = key.Curve.Params().BitSize
+		if s.KeyBits < minCurveBits {
+			flag(StatusWarning, "uses the weak curve %s", key.Curve.Params().Name)
+		}
+	case ed25519.PublicKey:
+		s.KeyBits = 256
+	case *dsa.PublicKey:
+		s.KeyBits = key.P.BitLen()
+		flag(StatusWarning, "has a DSA key")
+	}
+
+	if leaf || !bytes.Equal(c.RawIssuer, c.RawSubject) {
+		switch sig := strings.ToUpper(s.SignatureAlgorithm); {
+		case strings.Contains(sig, "MD5"), strings.Contains(sig, "MD2"):
+			flag(StatusCritical, "is signed with %s", s.SignatureAlgorithm)
+		case strings.Contains(sig, "SHA1"):
+			flag(StatusWarning, "is signed with %s", s.SignatureAlgorithm)
+		}
+	}
+	return s, findings
+}
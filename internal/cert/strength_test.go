@@ -0,0 +1,190 @@
+package cert_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sensu/cert-checks/internal/cert"
+	"github.com/sensu/cert-checks/internal/cert/testcert"
+)
+
+// Certificates Go can no longer create, generated by openssl req -x509 with
+// -md5 and a 1024 bit RSA key, and with a 1024 bit DSA key.
+const (
+	md5Certificate = `-----BEGIN CERTIFICATE-----
+MIICDDCCAXWgAwIBAgIUYmvtGZ9WwgCd772lz0ObCUvn+0wwDQYJKoZIhvcNAQEE
+BQAwFzEVMBMGA1UEAwwMbWQ1LnNlbnN1LmlvMCAXDTI2MTAxNjE5NTk1M1oYDzIx
+MjYwOTIyMTk1OTUzWjAXMRUwEwYDVQQDDAxtZDUuc2Vuc3UuaW8wgZ8wDQYJKoZI
+hvcNAQEBBQADgY0AMIGJAoGBAN08Q2wN/vAvaHJOw70ZB68FziGVoewTFn6jV+Vu
+fQDFB+1+ZyuYWaSNn6t1LR1SWiNIWfNUtmJi/4Eazbl1FXtlvR/0hICdcyKtifaw
+sqeRg+r+wYhXldhaSp29pyjukhHi5X7ntXeDMAdFMaesrXa4K14TNYUV/2yyuwdG
+IIPtAgMBAAGjUzBRMB0GA1UdDgQWBBRAmN6MNv+KT26IpAUm5TLh7VmeWTAfBgNV
+HSMEGDAWgBRAmN6MNv+KT26IpAUm5TLh7VmeWTAPBgNVHRMBAf8EBTADAQH/MA0G
+CSqGSIb3DQEBBAUAA4GBACSBJxvQN8pyYL4d6NhEjMjqLiombWk7haAc45qDmEYZ
+3//7yf0StZGvj7gLr5wX7YCIBq24x1AzW/BqV8/Zyni6dm6QTIm5LyDmdcg4bOfu
+dXatxNoT8zT+4Z+UGPrwgnLiN52St2wkX2c1pxlpu5u18F/kVPd68tErz+3AQXTi
+-----END CERTIFICATE-----
+`
+	dsaCertificate = `-----BEGIN CERTIFICATE-----
+MIIC6TCCApWgAwIBAgIUFKbX4kWCEdyJRNtqikvUbrKO+AgwCwYJYIZIAWUDBAMC
+MBcxFTATBgNVBAMMDGRzYS5zZW5zdS5pbzAgFw0yNjEwMTYxOTU5NTNaGA8yMTI2
+MDkyMjE5NTk1M1owFzEVMBMGA1UEAwwMZHNhLnNlbnN1LmlvMIIBwDCCATQGByqG
+SM44BAEwggEnAoGBANdCwbYssQ90XnXR8R8Tbi9/Y991NCy9h39qN7kx2XVH074B
+ndl2YM00LCAZ1HZW8WNL0e79woBBWhrtawVH9xR3ZJ7h/AUb65WCOLUNUxkFPNGD
+5aMreqbu57AW8Tqm7Hc8WEBh1knLowv03wHVpuFH1EipEZfpaGhvBVO72EoLAh0A
+yF9QIe4ZbL7dEgJs2VDTpfjKv90HsARV3PpOtQKBgQCM+NTg8kI5jBrUE6RrjYPS
+5s0HiFt3HsTaMoWRQi6Jb32xWPlLh8ds5nw50DJ2At8GiaJTHzlQVPBVSy2nc2EB
+GFImCMQ2xahqxmVcZmNyU6HAVnU5PdBVXB51a1ne7eRoOJDIfKVy+iDV9/GxfIGk
+BrUMksKkUp5XRQhVtjgf8AOBhQACgYEAiNMTOuibaFZCKEvKkOPPHfSII2U69u2a
+yGYFnluJ4LulxOkJBSYxhLnEXoL3rXwXEpQlBObK9HBKGUzV7wjPhAS9uTtgz/vp
+X3aeOcs4IJT1yNutq5slXnE1bq2NBIYcsobNmN2pQ0gGA6D7YBvaONtx+92uqoG3
+9Uq3MUDuotSjUzBRMB0GA1UdDgQWBBQm9yEnbX1RiVaenO9vH4Z/Zb5CrzAfBgNV
+HSMEGDAWgBQm9yEnbX1RiVaenO9vH4Z/Zb5CrzAPBgNVHRMBAf8EBTADAQH/MAsG
+CWCGSAFlAwQDAgNBADA+Ah0Am6stKsIK4kdbW7ihIZJHDCHAq668PWDngRpKtwId
+AKI/z8gZwKKqU70kU5gRbTwsLJRxZbRbhVCMSiA=
+-----END CERTIFICATE-----
+`
+)
+
+func TestCollectMetricsStrength(t *testing.T) {
+	ctx := context.Background()
+
+	issuedAt := time.Unix(1<<30, 0)
+	duration := time.Hour * 72
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatalf("could not write %s: %v", name, err)
+		}
+		return "file://" + path
+	}
+	selfSigned := func(host string, key crypto.Signer, opts ...testcert.Option) string {
+		_, certBytes, err := testcert.NewWithKey(host, issuedAt, duration, key, opts...)
+		if err != nil {
+			t.Fatalf("could not create certificate: %v", err)
+		}
+		return write(host+".pem", certBytes)
+	}
+	rsa1024, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("could not generate RSA key: %v", err)
+	}
+	rsa2048, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("could not generate RSA key: %v", err)
+	}
+	p224, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate ECDSA key: %v", err)
+	}
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate ECDSA key: %v", err)
+	}
+	sha1 := func(c *x509.Certificate) { c.SignatureAlgorithm = x509.SHA1WithRSA }
+	sha1Root, _, err := testcert.NewWithKey("sha1-root.sensu.io", issuedAt, duration, rsa2048, sha1)
+	if err != nil {
+		t.Fatalf("could not create certificate: %v", err)
+	}
+	_, sha1Chain, err := testcert.NewIssued("sha1.sensu.io", issuedAt, duration, sha1Root, sha1)
+	if err != nil {
+		t.Fatalf("could not create certificate: %v", err)
+	}
+	_, ed25519Bytes, err := testcert.New("ed25519.sensu.io", issuedAt, duration)
+	if err != nil {
+		t.Fatalf("could not create certificate: %v", err)
+	}
+
+	testCases := []struct {
+		Name           string
+		Cert           string
+		MinRSABits     int
+		Expected       []cert.Strength
+		ExpectedStatus cert.Status
+	}{
+		{
+			Name:           "RSA 2048",
+			Cert:           selfSigned("rsa2048.sensu.io", rsa2048),
+			Expected:       []cert.Strength{{KeyAlgorithm: "RSA", KeyBits: 2048, SignatureAlgorithm: "SHA256-RSA"}},
+			ExpectedStatus: cert.StatusOK,
+		}, {
+			Name:           "RSA 1024",
+			Cert:           selfSigned("rsa1024.sensu.io", rsa1024),
+			Expected:       []cert.Strength{{KeyAlgorithm: "RSA", KeyBits: 1024, SignatureAlgorithm: "SHA256-RSA", Weak: true}},
+			ExpectedStatus: cert.StatusCritical,
+		}, {
+			Name:           "RSA 2048 below configured minimum",
+			Cert:           selfSigned("rsa2048.sensu.io", rsa2048),
+			MinRSABits:     3072,
+			Expected:       []cert.Strength{{KeyAlgorithm: "RSA", KeyBits: 2048, SignatureAlgorithm: "SHA256-RSA", Weak: true}},
+			ExpectedStatus: cert.StatusCritical,
+		}, {
+			Name:           "ECDSA P-384",
+			Cert:           selfSigned("p384.sensu.io", p384),
+			Expected:       []cert.Strength{{KeyAlgorithm: "ECDSA", KeyBits: 384, SignatureAlgorithm: "ECDSA-SHA384"}},
+			ExpectedStatus: cert.StatusOK,
+		}, {
+			Name:           "ECDSA P-224",
+			Cert:           selfSigned("p224.sensu.io", p224),
+			Expected:       []cert.Strength{{KeyAlgorithm: "ECDSA", KeyBits: 224, SignatureAlgorithm: "ECDSA-SHA256", Weak: true}},
+			ExpectedStatus: cert.StatusWarning,
+		}, {
+			Name:           "Ed25519",
+			Cert:           write("ed25519.pem", ed25519Bytes),
+			Expected:       []cert.Strength{{KeyAlgorithm: "Ed25519", KeyBits: 256, SignatureAlgorithm: "Ed25519"}},
+			ExpectedStatus: cert.StatusOK,
+		}, {
+			Name: "SHA-1 leaf under SHA-1 root",
+			Cert: write("sha1.pem", sha1Chain),
+			Expected: []cert.Strength{
+				{KeyAlgorithm: "Ed25519", KeyBits: 256, SignatureAlgorithm: "SHA1-RSA", Weak: true},
+				{KeyAlgorithm: "RSA", KeyBits: 2048, SignatureAlgorithm: "SHA1-RSA"},
+			},
+			ExpectedStatus: cert.StatusWarning,
+		}, {
+			Name:           "MD5",
+			Cert:           write("md5.pem", []byte(md5Certificate)),
+			MinRSABits:     1024,
+			Expected:       []cert.Strength{{KeyAlgorithm: "RSA", KeyBits: 1024, SignatureAlgorithm: "MD5-RSA", Weak: true}},
+			ExpectedStatus: cert.StatusCritical,
+		}, {
+			Name:           "DSA",
+			Cert:           write("dsa.pem", []byte(dsaCertificate)),
+			Expected:       []cert.Strength{{KeyAlgorithm: "DSA", KeyBits: 1024, SignatureAlgorithm: "DSA-SHA256", Weak: true}},
+			ExpectedStatus: cert.StatusWarning,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			actual, err := collectSingle(t, ctx, tc.Cert, cert.Config{
+				Now:        func() time.Time { return issuedAt },
+				Strength:   true,
+				MinRSABits: tc.MinRSABits,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			var strengths []cert.Strength
+			for _, c := range actual.Chain {
+				strengths = append(strengths, *c.Strength)
+			}
+			if !reflect.DeepEqual(strengths, tc.Expected) {
+				t.Errorf("expected %v. actual: %v", tc.Expected, strengths)
+			}
+			if status := actual.Status(); status != tc.ExpectedStatus {
+				t.Errorf("expected status %v. actual: %v (%v)", tc.ExpectedStatus, status, actual.Findings)
+			}
+		})
+	}
+}
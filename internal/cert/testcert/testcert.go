@@ -2,6 +2,7 @@ package testcert
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/tls"
@@ -18,14 +19,78 @@ MC4CAQAwBQYDK2VwBCIEIFas9kzil+15Ywf4USE6HTQIFROAEpZX4BgWzR9KSLbo
 -----END PRIVATE KEY-----
 `)
 
-func New(host string, notBefore time.Time, duration time.Duration) (tls.Certificate, []byte, error) {
+// Option customises the template of a test certificate.
+type Option func(*x509.Certificate)
+
+// New creates a self-signed certificate for host signed with SigningKey.
+func New(host string, notBefore time.Time, duration time.Duration, opts ...Option) (tls.Certificate, []byte, error) {
+	pkBlock, _ := pem.Decode(SigningKey)
+	tmpKey, err := x509.ParsePKCS8PrivateKey(pkBlock.Bytes)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	return NewWithKey(host, notBefore, duration, tmpKey.(ed25519.PrivateKey), opts...)
+}
+
+// NewWithKey creates a self-signed certificate for host signed with key.
+func NewWithKey(host string, notBefore time.Time, duration time.Duration, key crypto.Signer, opts ...Option) (tls.Certificate, []byte, error) {
 	var tlsCert tls.Certificate
-	sn, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	temp, err := template(host, notBefore, duration, opts)
+	if err != nil {
+		return tlsCert, nil, err
+	}
+
+	b, err := x509.CreateCertificate(rand.Reader, temp, temp, key.Public(), key)
+	if err != nil {
+		return tlsCert, nil, err
+	}
+	var cert bytes.Buffer
+	if err := pem.Encode(&cert, &pem.Block{Type: "CERTIFICATE", Bytes: b}); err != nil {
+		return tlsCert, nil, err
+	}
+	tlsCert.Certificate = [][]byte{b}
+	tlsCert.PrivateKey = key
+	return tlsCert, cert.Bytes(), nil
+}
+
+// NewIssued creates a certificate for host with a freshly generated key, signed
+// by issuer. The returned key pair and PEM data include the issuer's chain.
+func NewIssued(host string, notBefore time.Time, duration time.Duration, issuer tls.Certificate, opts ...Option) (tls.Certificate, []byte, error) {
+	var tlsCert tls.Certificate
+	temp, err := template(host, notBefore, duration, opts)
+	if err != nil {
+		return tlsCert, nil, err
+	}
+	parent, err := x509.ParseCertificate(issuer.Certificate[0])
 	if err != nil {
 		return tlsCert, nil, err
 	}
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return tlsCert, nil, err
+	}
+	b, err := x509.CreateCertificate(rand.Reader, temp, parent, pub, issuer.PrivateKey.(crypto.Signer))
+	if err != nil {
+		return tlsCert, nil, err
+	}
+	tlsCert.Certificate = append([][]byte{b}, issuer.Certificate...)
+	tlsCert.PrivateKey = priv
+	var chain bytes.Buffer
+	for _, der := range tlsCert.Certificate {
+		if err := pem.Encode(&chain, &pem.Block{Type: "CERTIFICATE", Bytes: der}); err != nil {
+			return tlsCert, nil, err
+		}
+	}
+	return tlsCert, chain.Bytes(), nil
+}
+
+func template(host string, notBefore time.Time, duration time.Duration, opts []Option) (*x509.Certificate, error) {
+	sn, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
 
-	temp := x509.Certificate{
+	temp := &x509.Certificate{
 		SerialNumber: sn,
 		Subject: pkix.Name{
 			Organization:       []string{"Sumo Logic Inc"},
@@ -36,28 +101,14 @@ func New(host string, notBefore time.Time, duration time.Duration) (tls.Certific
 		NotAfter:  notBefore.Add(duration),
 
 		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
-		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
 		BasicConstraintsValid: true,
 
 		DNSNames: []string{host},
 		IsCA:     true,
 	}
-
-	pkBlock, _ := pem.Decode(SigningKey)
-	tmpKey, err := x509.ParsePKCS8PrivateKey(pkBlock.Bytes)
-	if err != nil {
-		return tlsCert, nil, err
-	}
-	priv := tmpKey.(ed25519.PrivateKey)
-
-	b, err := x509.CreateCertificate(rand.Reader, &temp, &temp, priv.Public(), priv)
-	if err != nil {
-		return tlsCert, nil, err
-	}
-	var cert bytes.Buffer
-	if err := pem.Encode(&cert, &pem.Block{Type: "CERTIFICATE", Bytes: b}); err != nil {
-		return tlsCert, nil, err
+	for _, opt := range opts {
+		opt(temp)
 	}
-	tlsCert, err = tls.X509KeyPair(cert.Bytes(), SigningKey)
-	return tlsCert, cert.Bytes(), err
+	return temp, nil
 }
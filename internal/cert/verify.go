@@ -0,0 +1,74 @@
+package cert
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Verification of a certificate chain against the trusted roots.
+type Verification struct {
+	Valid bool
+	// Err describes why verification failed
+	Err error
+}
+
+// verifyChain verifies the leaf of chain using the remaining certificates as
+// intermediates.
+func verifyChain(chain []*x509.Certificate, roots *x509.CertPool, now time.Time) *Verification {
+	intermediates := x509.NewCertPool()
+	for _, c := range chain[1:] {
+		intermediates.AddCert(c)
+	}
+	_, err := chain[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	return &Verification{Valid: err == nil, Err: err}
+}
+
+// loadRoots builds the pool of trusted roots from a CA bundle file and/or a
+// directory of CA certificates. The system roots are used when neither is set.
+func loadRoots(caFile, caDir string) (*x509.CertPool, error) {
+	if caFile == "" && caDir == "" {
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			return nil, fmt.Errorf("error loading system roots: %v", err)
+		}
+		return roots, nil
+	}
+	roots := x509.NewCertPool()
+	var files []string
+	if caFile != "" {
+		files = append(files, caFile)
+	}
+	if caDir != "" {
+		entries, err := os.ReadDir(caDir)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA directory: %v", err)
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				files = append(files, filepath.Join(caDir, entry.Name()))
+			}
+		}
+	}
+	found := false
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA file: %v", err)
+		}
+		if roots.AppendCertsFromPEM(data) {
+			found = true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("no CA certificates found")
+	}
+	return roots, nil
+}
@@ -0,0 +1,137 @@
+package cert_test
+
+import (
+	"context"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sensu/cert-checks/internal/cert"
+	"github.com/sensu/cert-checks/internal/cert/testcert"
+)
+
+func TestCollectMetricsVerify(t *testing.T) {
+	ctx := context.Background()
+
+	issuedAt := time.Unix(1<<30, 0)
+	duration := time.Hour * 72
+	root, rootBytes, err := testcert.New("root.sensu.io", issuedAt, duration)
+	if err != nil {
+		t.Fatalf("could not create root certificate: %v", err)
+	}
+	intermediate, _, err := testcert.NewIssued("intermediate.sensu.io", issuedAt, duration, root)
+	if err != nil {
+		t.Fatalf("could not create intermediate certificate: %v", err)
+	}
+	leaf, chainBytes, err := testcert.NewIssued("imposter.sensu.io", issuedAt, duration, intermediate)
+	if err != nil {
+		t.Fatalf("could not create leaf certificate: %v", err)
+	}
+	_, otherRootBytes, err := testcert.New("other.sensu.io", issuedAt, duration)
+	if err != nil {
+		t.Fatalf("could not create other root certificate: %v", err)
+	}
+	_, selfSignedBytes, err := testcert.New("imposter.sensu.io", issuedAt, duration)
+	if err != nil {
+		t.Fatalf("could not create self signed certificate: %v", err)
+	}
+
+	tmpDir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatalf("could not write %s: %v", name, err)
+		}
+		return path
+	}
+	chainPath := write("chain.pem", chainBytes)
+	// leaf without the intermediate
+	leafBytes := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Certificate[0]})
+	misChainedPath := write("mischained.pem", leafBytes)
+	selfSignedPath := write("selfsigned.pem", selfSignedBytes)
+	rootPath := write("root.pem", rootBytes)
+	otherRootPath := write("other.pem", otherRootBytes)
+	caDir := filepath.Join(tmpDir, "ca")
+	if err := os.Mkdir(caDir, 0755); err != nil {
+		t.Fatalf("could not create CA directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(caDir, "root.pem"), rootBytes, 0644); err != nil {
+		t.Fatalf("could not write root certificate to CA directory: %v", err)
+	}
+
+	testCases := []struct {
+		Name      string
+		Cert      string
+		CAFile    string
+		CADir     string
+		Valid     bool
+		ExpectErr bool
+	}{
+		{
+			Name:   "chain verifies against CA file",
+			Cert:   "file://" + chainPath,
+			CAFile: rootPath,
+			Valid:  true,
+		}, {
+			Name:  "chain verifies against CA directory",
+			Cert:  "file://" + chainPath,
+			CADir: caDir,
+			Valid: true,
+		}, {
+			Name:   "chain from another root",
+			Cert:   "file://" + chainPath,
+			CAFile: otherRootPath,
+		}, {
+			Name:   "chain missing intermediate",
+			Cert:   "file://" + misChainedPath,
+			CAFile: rootPath,
+		}, {
+			Name: "self signed against system roots",
+			Cert: "file://" + selfSignedPath,
+		}, {
+			Name:      "CA file without certificates",
+			Cert:      "file://" + chainPath,
+			CAFile:    write("empty.pem", nil),
+			ExpectErr: true,
+		}, {
+			Name:      "CA file not found",
+			Cert:      "file://" + chainPath,
+			CAFile:    filepath.Join(tmpDir, "does-not-exist.pem"),
+			ExpectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			actual, err := collectSingle(t, ctx, tc.Cert, cert.Config{
+				Now:    func() time.Time { return issuedAt },
+				Verify: true,
+				CAFile: tc.CAFile,
+				CADir:  tc.CADir,
+			})
+			if err != nil && !tc.ExpectErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if err != nil {
+				return
+			}
+			if tc.ExpectErr {
+				t.Fatal("expected error")
+			}
+			if actual.Verification == nil {
+				t.Fatal("expected chain verification")
+			}
+			if actual.Verification.Valid != tc.Valid {
+				t.Errorf("expected Valid to be %v. actual: %v (%v)", tc.Valid, actual.Verification.Valid, actual.Verification.Err)
+			}
+			if tc.Valid && actual.Status() != cert.StatusOK {
+				t.Errorf("expected status OK. actual: %s", actual.Status())
+			}
+			if !tc.Valid && actual.Status() != cert.StatusCritical {
+				t.Errorf("expected status CRITICAL. actual: %s", actual.Status())
+			}
+		})
+	}
+}
@@ -2,8 +2,15 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"math"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/sensu-community/sensu-plugin-sdk/sensu"
@@ -14,8 +21,50 @@ import (
 // Config represents the check plugin config.
 type Config struct {
 	sensu.PluginConfig
-	Cert       string
-	ServerName string
+	Certs         []string
+	ServerName    string
+	Warning       string
+	Critical      string
+	Verify        bool
+	CAFile        string
+	CADir         string
+	Concurrency   int
+	Format        string
+	Password      string
+	PasswordEnv   string
+	PasswordFile  string
+	Recursive     bool
+	Include       []string
+	Exclude       []string
+	KeyFile       string
+	ClientCert    string
+	ClientKey     string
+	ClientAuth    bool
+	OCSP          bool
+	Staple        bool
+	MustStaple    bool
+	CRL           bool
+	CRLFile       string
+	SCT           bool
+	CTLogList     string
+	MinSCTs       int
+	Strength      bool
+	MinRSABits    int
+	TLSAudit      bool
+	MinTLSVersion string
+	PinSHA256     []string
+	PinCertSHA256 []string
+	ExpectIssuer  []string
+	ExpectSubject []string
+	ExpectSAN     []string
+	ExpectOrg     []string
+
+	warning       time.Duration
+	critical      time.Duration
+	password      string
+	minTLSVersion uint16
+	pins          []cert.Pin
+	expect        cert.Expectations
 }
 
 var (
@@ -33,8 +82,8 @@ var (
 			Env:       "CHECK_CERT",
 			Argument:  "cert",
 			Shorthand: "c",
-			Usage:     "URL to certificate. Supports https, tcp, and file schemes",
-			Value:     &plugin.Cert,
+			Usage:     "URL to certificate. Supports https, tcp, smtp, imap, pop3, ftp, postgres, mysql, ldap, ldaps, file, pkcs12, jks, secret and kubeconfig schemes. Repeat or comma separate to check multiple certificates",
+			Value:     &plugin.Certs,
 		},
 		{
 			Path:      "servername",
@@ -44,6 +93,256 @@ var (
 			Usage:     "optional TLS servername extension argument",
 			Value:     &plugin.ServerName,
 		},
+		{
+			Path:     "warning",
+			Env:      "CHECK_WARNING",
+			Argument: "warning",
+			Usage:    "warn when the certificate expires within this threshold. Number of days or duration (ex: 30, 720h)",
+			Value:    &plugin.Warning,
+		},
+		{
+			Path:     "critical",
+			Env:      "CHECK_CRITICAL",
+			Argument: "critical",
+			Usage:    "critical when the certificate expires within this threshold. Number of days or duration (ex: 7, 168h)",
+			Value:    &plugin.Critical,
+		},
+		{
+			Path:     "verify",
+			Env:      "CHECK_VERIFY",
+			Argument: "verify",
+			Usage:    "verify the certificate chain against the system roots, or the roots given by --ca-file and --ca-dir",
+			Value:    &plugin.Verify,
+		},
+		{
+			Path:     "ca-file",
+			Env:      "CHECK_CA_FILE",
+			Argument: "ca-file",
+			Usage:    "PEM bundle of trusted CA certificates used to verify the chain. Implies --verify",
+			Value:    &plugin.CAFile,
+		},
+		{
+			Path:     "ca-dir",
+			Env:      "CHECK_CA_DIR",
+			Argument: "ca-dir",
+			Usage:    "directory of PEM encoded trusted CA certificates used to verify the chain. Implies --verify",
+			Value:    &plugin.CADir,
+		},
+		{
+			Path:     "concurrency",
+			Env:      "CHECK_CONCURRENCY",
+			Argument: "concurrency",
+			Default:  8,
+			Usage:    "maximum number of targets collected concurrently",
+			Value:    &plugin.Concurrency,
+		},
+		{
+			Path:     "format",
+			Env:      "CHECK_FORMAT",
+			Argument: "format",
+			Default:  "auto",
+			Usage:    "encoding of certificate files. One of auto, pem, der, pkcs12, jks, secret (Kubernetes Secret manifests) or kubeconfig",
+			Value:    &plugin.Format,
+		},
+		{
+			Path:     "password",
+			Env:      "CHECK_PASSWORD",
+			Argument: "password",
+			Secret:   true,
+			Usage:    "password of keystore files and encrypted private keys",
+			Value:    &plugin.Password,
+		},
+		{
+			Path:     "password-env",
+			Env:      "CHECK_PASSWORD_ENV",
+			Argument: "password-env",
+			Usage:    "name of the environment variable holding the password of keystore files and encrypted private keys",
+			Value:    &plugin.PasswordEnv,
+		},
+		{
+			Path:     "password-file",
+			Env:      "CHECK_PASSWORD_FILE",
+			Argument: "password-file",
+			Usage:    "path to a file holding the password of keystore files and encrypted private keys",
+			Value:    &plugin.PasswordFile,
+		},
+		{
+			Path:     "recursive",
+			Env:      "CHECK_RECURSIVE",
+			Argument: "recursive",
+			Usage:    "scan subdirectories of directories given as file locations",
+			Value:    &plugin.Recursive,
+		},
+		{
+			Path:     "include",
+			Env:      "CHECK_INCLUDE",
+			Argument: "include",
+			Usage:    "only check files in scanned directories whose name matches one of these glob patterns (ex: *.pem)",
+			Value:    &plugin.Include,
+		},
+		{
+			Path:     "exclude",
+			Env:      "CHECK_EXCLUDE",
+			Argument: "exclude",
+			Usage:    "skip files in scanned directories whose name matches one of these glob patterns (ex: privkey*)",
+			Value:    &plugin.Exclude,
+		},
+		{
+			Path:     "key-file",
+			Env:      "CHECK_KEY_FILE",
+			Argument: "key-file",
+			Usage:    "private key file that must match the certificate of a single --cert target. Encrypted keys are decrypted with the keystore password",
+			Value:    &plugin.KeyFile,
+		},
+		{
+			Path:     "client-cert",
+			Env:      "CHECK_CLIENT_CERT",
+			Argument: "client-cert",
+			Usage:    "PEM encoded client certificate presented to servers that request one",
+			Value:    &plugin.ClientCert,
+		},
+		{
+			Path:     "client-key",
+			Env:      "CHECK_CLIENT_KEY",
+			Argument: "client-key",
+			Usage:    "private key of --client-cert, when not in the certificate file",
+			Value:    &plugin.ClientKey,
+		},
+		{
+			Path:     "client-auth",
+			Env:      "CHECK_CLIENT_AUTH",
+			Argument: "client-auth",
+			Usage:    "report whether servers request a client certificate and the CA names they accept",
+			Value:    &plugin.ClientAuth,
+		},
+		{
+			Path:     "ocsp",
+			Env:      "CHECK_OCSP",
+			Argument: "ocsp",
+			Usage:    "query the OCSP responders of the certificate for its revocation status",
+			Value:    &plugin.OCSP,
+		},
+		{
+			Path:     "staple",
+			Env:      "CHECK_STAPLE",
+			Argument: "staple",
+			Usage:    "report and validate the OCSP response stapled by TLS servers",
+			Value:    &plugin.Staple,
+		},
+		{
+			Path:     "must-staple",
+			Env:      "CHECK_MUST_STAPLE",
+			Argument: "must-staple",
+			Usage:    "critical when a certificate with the OCSP Must-Staple extension is served without a staple. Implies --staple",
+			Value:    &plugin.MustStaple,
+		},
+		{
+			Path:     "crl",
+			Env:      "CHECK_CRL",
+			Argument: "crl",
+			Usage:    "look up the certificate in the CRL of its issuer, fetched from the certificate's http and file distribution points",
+			Value:    &plugin.CRL,
+		},
+		{
+			Path:     "crl-file",
+			Env:      "CHECK_CRL_FILE",
+			Argument: "crl-file",
+			Usage:    "PEM or DER encoded CRL used instead of the distribution points. Implies --crl",
+			Value:    &plugin.CRLFile,
+		},
+		{
+			Path:     "sct",
+			Env:      "CHECK_SCT",
+			Argument: "sct",
+			Usage:    "report the signed certificate timestamps from the certificate, the TLS handshake and stapled OCSP responses",
+			Value:    &plugin.SCT,
+		},
+		{
+			Path:     "ct-log-list",
+			Env:      "CHECK_CT_LOG_LIST",
+			Argument: "ct-log-list",
+			Usage:    "CT log list JSON file used to verify signed certificate timestamps. Implies --sct",
+			Value:    &plugin.CTLogList,
+		},
+		{
+			Path:     "min-scts",
+			Env:      "CHECK_MIN_SCTS",
+			Argument: "min-scts",
+			Usage:    "critical when fewer distinct logs issued signed certificate timestamps. Implies --sct",
+			Value:    &plugin.MinSCTs,
+		},
+		{
+			Path:     "strength",
+			Env:      "CHECK_STRENGTH",
+			Argument: "strength",
+			Usage:    "report the key and signature algorithms of the chain and flag weak keys, curves and MD5, SHA-1 or DSA use",
+			Value:    &plugin.Strength,
+		},
+		{
+			Path:     "min-rsa-bits",
+			Env:      "CHECK_MIN_RSA_BITS",
+			Argument: "min-rsa-bits",
+			Default:  cert.DefaultMinRSABits,
+			Usage:    "smallest RSA key size accepted by --strength",
+			Value:    &plugin.MinRSABits,
+		},
+		{
+			Path:     "tls-audit",
+			Env:      "CHECK_TLS_AUDIT",
+			Argument: "tls-audit",
+			Usage:    "enumerate the TLS protocol versions and cipher suites accepted by servers",
+			Value:    &plugin.TLSAudit,
+		},
+		{
+			Path:     "min-tls-version",
+			Env:      "CHECK_MIN_TLS_VERSION",
+			Argument: "min-tls-version",
+			Default:  "1.2",
+			Usage:    "oldest TLS protocol version --tls-audit accepts, one of 1.0, 1.1, 1.2, 1.3 or none",
+			Value:    &plugin.MinTLSVersion,
+		},
+		{
+			Path:     "pin-sha256",
+			Env:      "CHECK_PIN_SHA256",
+			Argument: "pin-sha256",
+			Usage:    "SHA-256 hash of a public key (SPKI) that must be in the chain, base64 or hex encoded. Repeat for backup pins, critical when none match",
+			Value:    &plugin.PinSHA256,
+		},
+		{
+			Path:     "pin-cert-sha256",
+			Env:      "CHECK_PIN_CERT_SHA256",
+			Argument: "pin-cert-sha256",
+			Usage:    "SHA-256 fingerprint of a certificate that must be in the chain, base64 or hex encoded. Repeat for backup pins, critical when none match",
+			Value:    &plugin.PinCertSHA256,
+		},
+		{
+			Path:     "expect-issuer",
+			Env:      "CHECK_EXPECT_ISSUER",
+			Argument: "expect-issuer",
+			Usage:    "critical unless the leaf issuer common name or distinguished name matches one of these glob or re: prefixed regular expression patterns",
+			Value:    &plugin.ExpectIssuer,
+		},
+		{
+			Path:     "expect-subject",
+			Env:      "CHECK_EXPECT_SUBJECT",
+			Argument: "expect-subject",
+			Usage:    "critical unless the leaf subject common name or distinguished name matches one of these glob or re: prefixed regular expression patterns",
+			Value:    &plugin.ExpectSubject,
+		},
+		{
+			Path:     "expect-san",
+			Env:      "CHECK_EXPECT_SAN",
+			Argument: "expect-san",
+			Usage:    "critical unless each of these glob or re: prefixed regular expression patterns matches a subject alternative name of the leaf. In globs * also matches /",
+			Value:    &plugin.ExpectSAN,
+		},
+		{
+			Path:     "expect-org",
+			Env:      "CHECK_EXPECT_ORG",
+			Argument: "expect-org",
+			Usage:    "critical unless a leaf subject organization matches one of these glob or re: prefixed regular expression patterns",
+			Value:    &plugin.ExpectOrg,
+		},
 	}
 )
 
@@ -64,24 +363,353 @@ func main() {
 }
 
 func checkArgs(event *types.Event) (int, error) {
-	if plugin.Cert == "" {
+	plugin.Certs = splitTargets(plugin.Certs)
+	if len(plugin.Certs) == 0 {
 		return sensu.CheckStateWarning, fmt.Errorf("--cert is required. must be URL to certificate. ex: file:///var/run/app/site.crt, https://dev1.sensu.io:8443, tcp://127.0.0.1:443")
 	}
+	if plugin.Concurrency < 1 {
+		return sensu.CheckStateWarning, fmt.Errorf("--concurrency must be at least 1")
+	}
+	switch plugin.Format {
+	case "auto", cert.FormatPEM, cert.FormatDER, cert.FormatPKCS12, cert.FormatJKS, cert.FormatSecret, cert.FormatKubeconfig:
+	default:
+		return sensu.CheckStateWarning, fmt.Errorf("--format must be one of auto, pem, der, pkcs12, jks, secret or kubeconfig")
+	}
+	var err error
+	if plugin.warning, err = parseThreshold(plugin.Warning); err != nil {
+		return sensu.CheckStateWarning, fmt.Errorf("invalid --warning: %v", err)
+	}
+	if plugin.critical, err = parseThreshold(plugin.Critical); err != nil {
+		return sensu.CheckStateWarning, fmt.Errorf("invalid --critical: %v", err)
+	}
+	if plugin.warning > 0 && plugin.warning < plugin.critical {
+		return sensu.CheckStateWarning, fmt.Errorf("--warning must not be less than --critical")
+	}
+	if plugin.password, err = password(plugin.Password, plugin.PasswordEnv, plugin.PasswordFile); err != nil {
+		return sensu.CheckStateWarning, err
+	}
+	if plugin.minTLSVersion, err = parseTLSVersion(plugin.MinTLSVersion); err != nil {
+		return sensu.CheckStateWarning, fmt.Errorf("invalid --min-tls-version: %v", err)
+	}
+	if plugin.pins, err = parsePins(plugin.PinSHA256, plugin.PinCertSHA256); err != nil {
+		return sensu.CheckStateWarning, err
+	}
+	if plugin.expect, err = parseExpectations(plugin.ExpectIssuer, plugin.ExpectSubject, plugin.ExpectSAN, plugin.ExpectOrg); err != nil {
+		return sensu.CheckStateWarning, err
+	}
+	if plugin.MinSCTs < 0 {
+		return sensu.CheckStateWarning, fmt.Errorf("--min-scts must not be negative")
+	}
+	if plugin.ClientKey != "" && plugin.ClientCert == "" {
+		return sensu.CheckStateWarning, fmt.Errorf("--client-key requires --client-cert")
+	}
+	if plugin.KeyFile != "" && len(plugin.Certs) > 1 {
+		return sensu.CheckStateWarning, fmt.Errorf("--key-file can only be used with a single --cert target")
+	}
+	for _, pattern := range append(plugin.Include, plugin.Exclude...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return sensu.CheckStateWarning, fmt.Errorf("invalid file name pattern %q", pattern)
+		}
+	}
 	return sensu.CheckStateOK, nil
 }
 
+// password of keystores, given directly, by environment variable name or by
+// file. Only one source may be set.
+func password(value, env, file string) (string, error) {
+	sources := 0
+	for _, s := range []string{value, env, file} {
+		if s != "" {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return "", fmt.Errorf("only one of --password, --password-env and --password-file may be set")
+	}
+	switch {
+	case env != "":
+		p, ok := os.LookupEnv(env)
+		if !ok {
+			return "", fmt.Errorf("--password-env: environment variable %s is not set", env)
+		}
+		return p, nil
+	case file != "":
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("--password-file: %v", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	return value, nil
+}
+
+// splitTargets splits comma separated targets and drops empty entries.
+func splitTargets(certs []string) []string {
+	var targets []string
+	for _, c := range certs {
+		for _, target := range strings.Split(c, ",") {
+			if target = strings.TrimSpace(target); target != "" {
+				targets = append(targets, target)
+			}
+		}
+	}
+	return targets
+}
+
+// parseThreshold parses a threshold given as a number of days or as a Go
+// duration string. An empty threshold is disabled.
+func parseThreshold(threshold string) (time.Duration, error) {
+	if threshold == "" {
+		return 0, nil
+	}
+	var d time.Duration
+	if days, err := strconv.ParseFloat(threshold, 64); err == nil {
+		if math.IsNaN(days) || math.IsInf(days, 0) {
+			return 0, fmt.Errorf("%q is not a finite number of days", threshold)
+		}
+		// converting beyond the range of a Duration would wrap around
+		if math.Abs(days*float64(24*time.Hour)) >= math.MaxInt64 {
+			return 0, fmt.Errorf("%q is out of range, at most %d days are supported", threshold, int64(math.MaxInt64/int64(24*time.Hour)))
+		}
+		d = time.Duration(days * float64(24*time.Hour))
+	} else if d, err = time.ParseDuration(threshold); err != nil {
+		return 0, fmt.Errorf("%q is neither a number of days nor a duration", threshold)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("%q must not be negative", threshold)
+	}
+	return d, nil
+}
+
+// parseTLSVersion parses a TLS protocol version such as 1.2. An empty
+// version or none disables the policy.
+func parseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "", "none":
+		return 0, nil
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("%q is not one of 1.0, 1.1, 1.2, 1.3 or none", version)
+}
+
+// parsePins parses the SPKI and certificate pins.
+func parsePins(spki, certs []string) ([]cert.Pin, error) {
+	var pins []cert.Pin
+	for _, p := range []struct {
+		kind, option string
+		values       []string
+	}{
+		{cert.PinSPKI, "--pin-sha256", spki},
+		{cert.PinCertificate, "--pin-cert-sha256", certs},
+	} {
+		for _, v := range p.values {
+			pin, err := cert.ParsePin(p.kind, v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %v", p.option, err)
+			}
+			pins = append(pins, pin)
+		}
+	}
+	return pins, nil
+}
+
+// parseExpectations parses the patterns of the --expect options.
+func parseExpectations(issuer, subject, san, org []string) (cert.Expectations, error) {
+	var expect cert.Expectations
+	for _, e := range []struct {
+		option   string
+		values   []string
+		patterns *[]cert.Pattern
+	}{
+		{"--expect-issuer", issuer, &expect.Issuer},
+		{"--expect-subject", subject, &expect.Subject},
+		{"--expect-san", san, &expect.SAN},
+		{"--expect-org", org, &expect.Org},
+	} {
+		for _, v := range e.values {
+			p, err := cert.ParsePattern(v)
+			if err != nil {
+				return expect, fmt.Errorf("invalid %s: %v", e.option, err)
+			}
+			*e.patterns = append(*e.patterns, p)
+		}
+	}
+	return expect, nil
+}
+
 func executeCheck(event *types.Event) (int, error) {
 	ctx := context.Background()
-	if plugin.Timeout > 0 {
+	timeout := time.Second * time.Duration(plugin.Timeout)
+	if timeout > 0 {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, time.Second*time.Duration(plugin.Timeout))
+		ctx, cancel = context.WithTimeout(ctx, timeout)
 		defer cancel()
 	}
-	metrics, err := cert.CollectMetrics(ctx, plugin.Cert, cert.Config{ServerName: plugin.ServerName})
+	perTarget := targetTimeout(timeout, len(plugin.Certs), plugin.Concurrency)
+	results := collect(ctx, plugin.Certs, plugin.Concurrency, perTarget, cert.Config{
+		ServerName:       plugin.ServerName,
+		Warning:          plugin.warning,
+		Critical:         plugin.critical,
+		Verify:           plugin.Verify || plugin.CAFile != "" || plugin.CADir != "",
+		CAFile:           plugin.CAFile,
+		CADir:            plugin.CADir,
+		Format:           fileFormat(plugin.Format),
+		Password:         plugin.password,
+		Recursive:        plugin.Recursive,
+		Include:          plugin.Include,
+		Exclude:          plugin.Exclude,
+		KeyFile:          plugin.KeyFile,
+		ClientCertFile:   plugin.ClientCert,
+		ClientKeyFile:    plugin.ClientKey,
+		ReportClientAuth: plugin.ClientAuth,
+		OCSP:             plugin.OCSP,
+		Staple:           plugin.Staple,
+		MustStaple:       plugin.MustStaple,
+		CRL:              plugin.CRL || plugin.CRLFile != "",
+		CRLFile:          plugin.CRLFile,
+		SCT:              plugin.SCT || plugin.CTLogList != "" || plugin.MinSCTs > 0,
+		CTLogList:        plugin.CTLogList,
+		MinSCTs:          plugin.MinSCTs,
+		Strength:         plugin.Strength,
+		MinRSABits:       plugin.MinRSABits,
+		AuditTLS:         plugin.TLSAudit,
+		MinTLSVersion:    plugin.minTLSVersion,
+		Pins:             plugin.pins,
+		Expect:           plugin.expect,
+	})
+	status := worstStatus(results)
+	fmt.Println(summary(status, results))
+	fmt.Println(cert.Output(results...))
+	return checkState(status), nil
+}
+
+// collect metrics for every target, labelling each with a target tag. At most
+// concurrency targets are collected at once, each bounded by timeout when it
+// is non-zero. Targets that cannot be collected are reported with a critical
+// finding. Results are sorted by target, keeping the order of the entries of
+// each target.
+func collect(ctx context.Context, targets []string, concurrency int, timeout time.Duration, cfg cert.Config) []cert.Metrics {
+	collected := make([][]cert.Metrics, len(targets))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, target string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			collected[i] = collectTarget(ctx, target, timeout, cfg)
+		}(i, target)
+	}
+	wg.Wait()
+	var results []cert.Metrics
+	for _, metrics := range collected {
+		results = append(results, metrics...)
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Tags["target"] < results[j].Tags["target"]
+	})
+	return results
+}
+
+func collectTarget(ctx context.Context, target string, timeout time.Duration, cfg cert.Config) []cert.Metrics {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	results, err := cert.CollectMetrics(ctx, target, cfg)
 	if err != nil {
-		fmt.Printf("cert-checks failed with error: %s\n", err.Error())
-		return sensu.CheckStateCritical, nil
+		results = []cert.Metrics{{
+			EvaluatedAt: time.Now(),
+			Err:         err,
+			Findings:    []cert.Finding{{Status: cert.StatusCritical, Message: err.Error()}},
+		}}
+	}
+	for i := range results {
+		if results[i].Tags == nil {
+			results[i].Tags = map[string]string{}
+		}
+		results[i].Tags["target"] = target
+	}
+	return results
+}
+
+// targetTimeout divides the check timeout between the batches of targets that
+// run concurrently, so that all targets complete within the check timeout.
+func targetTimeout(timeout time.Duration, targets, concurrency int) time.Duration {
+	if timeout <= 0 || targets == 0 {
+		return 0
+	}
+	batches := (targets + concurrency - 1) / concurrency
+	return timeout / time.Duration(batches)
+}
+
+// fileFormat maps the --format option to a cert package file format.
+func fileFormat(format string) string {
+	if format == "auto" {
+		return cert.FormatAuto
+	}
+	return format
+}
+
+func worstStatus(results []cert.Metrics) cert.Status {
+	status := cert.StatusOK
+	for _, m := range results {
+		if s := m.Status(); s > status {
+			status = s
+		}
+	}
+	return status
+}
+
+// maxSummaryMessages is the number of findings listed in the summary.
+const maxSummaryMessages = 10
+
+// summary is a human readable line describing the check result. It is
+// written as a comment so the output remains valid prometheus text.
+func summary(status cert.Status, results []cert.Metrics) string {
+	if status == cert.StatusOK {
+		earliest := results[0].ChainMinSecondsUntilExpires
+		for _, m := range results[1:] {
+			if m.ChainMinSecondsUntilExpires < earliest {
+				earliest = m.ChainMinSecondsUntilExpires
+			}
+		}
+		targets := map[string]bool{}
+		for _, m := range results {
+			targets[m.Tags["target"]] = true
+		}
+		return fmt.Sprintf("# cert-checks %s: %d target(s) checked, earliest expiry in %.1f days", status, len(targets), float64(earliest)/(60*60*24))
+	}
+	var messages []string
+	for _, m := range results {
+		for _, f := range m.Findings {
+			messages = append(messages, fmt.Sprintf("%s: %s", m.Tags["target"], f.Message))
+		}
+	}
+	// keep the summary readable for trust stores with many certificates
+	if len(messages) > maxSummaryMessages {
+		more := len(messages) - maxSummaryMessages
+		messages = append(messages[:maxSummaryMessages], fmt.Sprintf("and %d more", more))
+	}
+	return fmt.Sprintf("# cert-checks %s: %s", status, strings.Join(messages, "; "))
+}
+
+func checkState(status cert.Status) int {
+	switch status {
+	case cert.StatusOK:
+		return sensu.CheckStateOK
+	case cert.StatusWarning:
+		return sensu.CheckStateWarning
+	default:
+		return sensu.CheckStateCritical
 	}
-	fmt.Println(metrics.Output())
-	return sensu.CheckStateOK, nil
 }
@@ -1,8 +1,255 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/sensu/cert-checks/internal/cert"
+	"github.com/sensu/cert-checks/internal/cert/testcert"
 )
 
 func TestMain(t *testing.T) {
 }
+
+func TestParseThreshold(t *testing.T) {
+	testCases := []struct {
+		Threshold string
+		Expected  time.Duration
+		ExpectErr bool
+	}{
+		{Threshold: "", Expected: 0},
+		{Threshold: "30", Expected: 30 * 24 * time.Hour},
+		{Threshold: "0.5", Expected: 12 * time.Hour},
+		{Threshold: "720h", Expected: 720 * time.Hour},
+		{Threshold: "90m", Expected: 90 * time.Minute},
+		{Threshold: "-1", ExpectErr: true},
+		{Threshold: "-1h", ExpectErr: true},
+		{Threshold: "30 days", ExpectErr: true},
+		{Threshold: "NaN", ExpectErr: true},
+		{Threshold: "Inf", ExpectErr: true},
+		{Threshold: "+Inf", ExpectErr: true},
+		{Threshold: "-Inf", ExpectErr: true},
+		{Threshold: "106751", Expected: 106751 * 24 * time.Hour},
+		{Threshold: "200000", ExpectErr: true},
+		{Threshold: "-200000", ExpectErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Threshold, func(t *testing.T) {
+			actual, err := parseThreshold(tc.Threshold)
+			if err != nil && !tc.ExpectErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if err == nil && tc.ExpectErr {
+				t.Fatalf("expected error parsing %q", tc.Threshold)
+			}
+			if actual != tc.Expected {
+				t.Errorf("expected %v. actual: %v", tc.Expected, actual)
+			}
+		})
+	}
+}
+
+func TestParseTLSVersion(t *testing.T) {
+	testCases := []struct {
+		Version   string
+		Expected  uint16
+		ExpectErr bool
+	}{
+		{Version: "", Expected: 0},
+		{Version: "none", Expected: 0},
+		{Version: "1.0", Expected: tls.VersionTLS10},
+		{Version: "1.2", Expected: tls.VersionTLS12},
+		{Version: "1.3", Expected: tls.VersionTLS13},
+		{Version: "TLS 1.2", ExpectErr: true},
+		{Version: "1.4", ExpectErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Version, func(t *testing.T) {
+			actual, err := parseTLSVersion(tc.Version)
+			if err != nil && !tc.ExpectErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if err == nil && tc.ExpectErr {
+				t.Fatalf("expected error parsing %q", tc.Version)
+			}
+			if actual != tc.Expected {
+				t.Errorf("expected %v. actual: %v", tc.Expected, actual)
+			}
+		})
+	}
+}
+
+func TestParsePins(t *testing.T) {
+	spki := "sha256/" + strings.Repeat("A", 43) + "="
+	fingerprint := strings.Repeat("ab", 32)
+	pins, err := parsePins([]string{spki}, []string{fingerprint})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(pins) != 2 || pins[0].Kind != cert.PinSPKI || pins[0].String() != spki || pins[1].Kind != cert.PinCertificate || pins[1].String() != fingerprint {
+		t.Errorf("expected SPKI pin %s and certificate pin %s. actual: %v", spki, fingerprint, pins)
+	}
+	if _, err := parsePins(nil, []string{"abcd"}); err == nil || !strings.Contains(err.Error(), "--pin-cert-sha256") {
+		t.Errorf("expected --pin-cert-sha256 error. actual: %v", err)
+	}
+}
+
+func TestParseExpectations(t *testing.T) {
+	expect, err := parseExpectations([]string{"R3", "re:^E[0-9]$"}, nil, []string{"*.sensu.io"}, []string{"Sensu"})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(expect.Issuer) != 2 || len(expect.Subject) != 0 || len(expect.SAN) != 1 || len(expect.Org) != 1 {
+		t.Errorf("expected 2 issuer, 1 SAN and 1 org pattern. actual: %v", expect)
+	}
+	if _, err := parseExpectations(nil, nil, []string{"re:("}, nil); err == nil || !strings.Contains(err.Error(), "--expect-san") {
+		t.Errorf("expected --expect-san error. actual: %v", err)
+	}
+}
+
+func TestSplitTargets(t *testing.T) {
+	actual := splitTargets([]string{"file:///a.pem,https://sensu.io", " tcp://127.0.0.1:443 ", ""})
+	expected := []string{"file:///a.pem", "https://sensu.io", "tcp://127.0.0.1:443"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v. actual: %v", expected, actual)
+	}
+}
+
+func TestCollect(t *testing.T) {
+	issuedAt := time.Unix(1<<30, 0)
+	duration := time.Hour * 72
+	_, certBytes, err := testcert.New("imposter.sensu.io", issuedAt, duration)
+	if err != nil {
+		t.Fatalf("could not create test certificate: %v", err)
+	}
+	testCertPath := t.TempDir() + "/testcert.pem"
+	if err := os.WriteFile(testCertPath, certBytes, 0644); err != nil {
+		t.Fatalf("could not write test certificate to file: %v", err)
+	}
+
+	targets := []string{"file://" + testCertPath, "file:///does/not/exist.pem"}
+	results := collect(context.Background(), targets, 2, time.Second, cert.Config{
+		Now: func() time.Time { return issuedAt },
+	})
+	if len(results) != len(targets) {
+		t.Fatalf("expected %d results. actual: %d", len(targets), len(results))
+	}
+	// results are sorted by target
+	if results[0].Tags["target"] != targets[1] || results[1].Tags["target"] != targets[0] {
+		t.Errorf("expected results sorted by target. actual: %q, %q", results[0].Tags["target"], results[1].Tags["target"])
+	}
+	if results[0].Err == nil || results[0].Status() != cert.StatusCritical {
+		t.Errorf("expected missing file to fail. actual: %s", results[0].Status())
+	}
+	if results[1].Err != nil || results[1].Status() != cert.StatusOK {
+		t.Errorf("expected certificate file to be OK. actual: %s %v", results[1].Status(), results[1].Err)
+	}
+	if status := worstStatus(results); status != cert.StatusCritical {
+		t.Errorf("expected worst status to be critical. actual: %s", status)
+	}
+
+	// every entry of a target is a result tagged with the target
+	scanDir := t.TempDir()
+	for _, name := range []string{"a.pem", "b.pem"} {
+		if err := os.WriteFile(filepath.Join(scanDir, name), certBytes, 0644); err != nil {
+			t.Fatalf("could not write test certificate to file: %v", err)
+		}
+	}
+	results = collect(context.Background(), []string{"file://" + scanDir}, 1, time.Second, cert.Config{
+		Now: func() time.Time { return issuedAt },
+	})
+	if len(results) != 2 {
+		t.Fatalf("expected a result for every file. actual: %d", len(results))
+	}
+	for _, m := range results {
+		if m.Tags["target"] != "file://"+scanDir || m.Tags["file"] == "" {
+			t.Errorf("expected result tagged with target and file. actual: %v", m.Tags)
+		}
+	}
+	if actual := summary(cert.StatusOK, results); !strings.Contains(actual, "1 target(s) checked") {
+		t.Errorf("expected a single target in summary. actual: %s", actual)
+	}
+}
+
+func TestTargetTimeout(t *testing.T) {
+	testCases := []struct {
+		Timeout     time.Duration
+		Targets     int
+		Concurrency int
+		Expected    time.Duration
+	}{
+		{Timeout: 0, Targets: 10, Concurrency: 2, Expected: 0},
+		{Timeout: time.Minute, Targets: 1, Concurrency: 8, Expected: time.Minute},
+		{Timeout: time.Minute, Targets: 8, Concurrency: 8, Expected: time.Minute},
+		{Timeout: time.Minute, Targets: 9, Concurrency: 8, Expected: 30 * time.Second},
+		{Timeout: time.Minute, Targets: 6, Concurrency: 1, Expected: 10 * time.Second},
+	}
+	for _, tc := range testCases {
+		actual := targetTimeout(tc.Timeout, tc.Targets, tc.Concurrency)
+		if actual != tc.Expected {
+			t.Errorf("targetTimeout(%v, %d, %d) expected %v. actual: %v", tc.Timeout, tc.Targets, tc.Concurrency, tc.Expected, actual)
+		}
+	}
+}
+
+func TestPassword(t *testing.T) {
+	passwordFile := t.TempDir() + "/password"
+	if err := os.WriteFile(passwordFile, []byte("from-file\n"), 0600); err != nil {
+		t.Fatalf("could not write password file: %v", err)
+	}
+	os.Setenv("CERT_CHECKS_TEST_PASSWORD", "from-env")
+	defer os.Unsetenv("CERT_CHECKS_TEST_PASSWORD")
+
+	testCases := []struct {
+		Name      string
+		Value     string
+		Env       string
+		File      string
+		Expected  string
+		ExpectErr bool
+	}{
+		{Name: "none"},
+		{Name: "value", Value: "from-value", Expected: "from-value"},
+		{Name: "env", Env: "CERT_CHECKS_TEST_PASSWORD", Expected: "from-env"},
+		{Name: "file", File: passwordFile, Expected: "from-file"},
+		{Name: "env not set", Env: "CERT_CHECKS_TEST_NOT_SET", ExpectErr: true},
+		{Name: "file not found", File: passwordFile + ".missing", ExpectErr: true},
+		{Name: "multiple sources", Value: "from-value", File: passwordFile, ExpectErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			actual, err := password(tc.Value, tc.Env, tc.File)
+			if err != nil && !tc.ExpectErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if err == nil && tc.ExpectErr {
+				t.Fatal("expected error")
+			}
+			if actual != tc.Expected {
+				t.Errorf("expected %q. actual: %q", tc.Expected, actual)
+			}
+		})
+	}
+}
+
+func TestSummary(t *testing.T) {
+	var findings []cert.Finding
+	for i := 0; i < maxSummaryMessages+5; i++ {
+		findings = append(findings, cert.Finding{Status: cert.StatusWarning, Message: fmt.Sprintf("finding %d", i)})
+	}
+	results := []cert.Metrics{{Tags: map[string]string{"target": "jks:///truststore.jks"}, Findings: findings}}
+	actual := summary(cert.StatusWarning, results)
+	if !strings.HasPrefix(actual, "# cert-checks WARNING: jks:///truststore.jks: finding 0; ") {
+		t.Errorf("unexpected summary: %s", actual)
+	}
+	if !strings.HasSuffix(actual, "; and 5 more") {
+		t.Errorf("expected summary to be truncated: %s", actual)
+	}
+}